@@ -0,0 +1,24 @@
+package cmd
+
+// maxReportedIds is the number of record ids logged for the unconfirmed records
+const maxReportedIds = 10
+
+// logAccounting logs the accounting of the records sent to the detection engine:
+// the records sent, analysed and with risks, the records not confirmed as analysed and the anomalies.
+func logAccounting() {
+	s := recordAccounting.Summary()
+	if s.Sent == 0 {
+		return
+	}
+	logger.info("records accounted", "sent", s.Sent, "analysed", s.Confirmed, "with_risks", s.WithFindings)
+	if len(s.Unconfirmed) > 0 {
+		ids := s.Unconfirmed
+		if len(ids) > maxReportedIds {
+			ids = ids[:maxReportedIds]
+		}
+		logger.warn("records not confirmed as analysed", "count", len(s.Unconfirmed), "record_ids", ids)
+	}
+	for _, a := range s.Anomalies {
+		logger.warn("anomaly", "detail", a)
+	}
+}
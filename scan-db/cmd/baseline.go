@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	pb "github.com/BluBracket/database-risk-scanner/grpc/api"
+	"github.com/bserdar/jsonstream"
+	"github.com/pkg/errors"
+)
+
+// baseline holds the risks of a previous scan output to report only new risks.
+// risks are matched by fingerprint, i.e. table, column, record id, key, type and value hash.
+// line and column numbers are not part of the fingerprint, so edits around a known risk do not make it new.
+type baseline struct {
+	// risks holds the baseline risks by fingerprint as read from the previous output
+	risks map[string]map[string]interface{}
+	// seen holds the fingerprints of the baseline risks found again, including the risks dropped by filters
+	seen map[string]bool
+}
+
+// loadBaseline reads the risks from a previous scan output in json lines format.
+// lines which are not risks, like the hash audit summary or disappeared risks, are skipped.
+func loadBaseline(path string) (b *baseline, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		err = errors.Wrap(err, "failed to open baseline file")
+		return
+	}
+	defer f.Close()
+	b = &baseline{risks: map[string]map[string]interface{}{}, seen: map[string]bool{}}
+	dec := json.NewDecoder(f)
+	for {
+		var r map[string]interface{}
+		err = dec.Decode(&r)
+		if err == io.EOF {
+			err = nil
+			break
+		}
+		if err != nil {
+			err = errors.Wrapf(err, "failed to parse baseline file %s", path)
+			return
+		}
+		if _, ok := r["Type"]; !ok || r["Disappeared"] == true {
+			continue
+		}
+		b.risks[fingerprint(str(r["Table"]), str(r["Column"]), str(r["RecordId"]), str(r["Key"]), str(r["Type"]), str(r["Value"]))] = r
+	}
+	return
+}
+
+// contains tells if the risk is in the baseline and marks it as seen.
+// key is the key of the record in key/value mode, else empty.
+func (b *baseline) contains(table, column, recordId, key string, risk *pb.Risk) bool {
+	fp := fingerprint(table, column, recordId, key, risk.Type, risk.Value)
+	if _, ok := b.risks[fp]; !ok {
+		return false
+	}
+	b.seen[fp] = true
+	return true
+}
+
+// writeDisappeared writes the baseline risks which were not found again to the output
+// with 'Disappeared'. it returns their count.
+func (b *baseline) writeDisappeared(out jsonstream.LineWriter) (count int, err error) {
+	var fps []string
+	for fp := range b.risks {
+		if !b.seen[fp] {
+			fps = append(fps, fp)
+		}
+	}
+	sort.Strings(fps)
+	for _, fp := range fps {
+		r := b.risks[fp]
+		r["Disappeared"] = true
+		err = out.Marshal(r)
+		if err != nil {
+			err = errors.Wrap(err, "failed writing disappeared risk to output")
+			return
+		}
+		count++
+	}
+	return
+}
+
+// fingerprint identifies a risk across scans
+func fingerprint(table, column, recordId, key, riskType, value string) string {
+	return hashValue(fmt.Sprintf("%s\x00%s\x00%s\x00%s\x00%s\x00%s", table, column, recordId, key, riskType, hashValue(value)))
+}
+
+// str returns the string value of a json field, or an empty string if it is not a string
+func str(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
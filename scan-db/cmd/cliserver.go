@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// blubracketProcessName is the name of BluBracket CLI binary
+const blubracketProcessName = "blubracket"
+
+// cliStopTimeout is how long a BluBracket CLI process is given to exit once asked to, before it is killed
+const cliStopTimeout = 3 * time.Second
+
+// cliServer is a BluBracket CLI process serving gRPC on a unix socket
+type cliServer struct {
+	cmd    *exec.Cmd
+	socket string
+	// exited receives the error describing how the process exited
+	exited chan error
+	// done is closed when the process exited
+	done chan struct{}
+	// exitErr describes how the process exited, once done is closed
+	exitErr error
+}
+
+// startCLIServer launches the BluBracket CLI binary as a local gRPC server process for the worker,
+// with the '--engine-arg' arguments and the environment given by engineEnv.
+// it also establishes a connection to the server.
+// the binary is checked against the '--engine-sha256' pin on each start, as it may be replaced meanwhile.
+// the process does not get the interrupt signals of the terminal, so it keeps serving
+// while the scan is stopped gracefully. it is stopped with stop.
+func startCLIServer(ctx context.Context, bin string, worker int) (s *cliServer, conn *grpc.ClientConn, err error) {
+	err = verifyEngineDigest(bin)
+	if err != nil {
+		return
+	}
+	logger.info("starting BluBracket local gRPC server", "worker", worker, "path", bin)
+	s = &cliServer{
+		socket: filepath.Join(os.TempDir(), fmt.Sprintf("blubracket.grpcserver.dbscan-%d-%d", os.Getpid(), worker)),
+		exited: make(chan error, 1),
+		done:   make(chan struct{}),
+	}
+	serverUri := "unix:" + s.socket
+	args := append(append([]string{"serve"}, engineArgs...), serverUri)
+	s.cmd = exec.Command(bin, args...)
+	s.cmd.Env = engineEnv()
+	// the output of the process is logged line by line, so stdout is left to the findings.
+	// the stderr tail is kept to report why the process exited.
+	stdout := newLineLogger("engine", blubracketProcessName, "worker", worker, "stream", "stdout")
+	stderr := newLineLogger("engine", blubracketProcessName, "worker", worker, "stream", "stderr")
+	stderrTail := newTailWriter(stderrTailSize)
+	s.cmd.Stdout = stdout
+	s.cmd.Stderr = io.MultiWriter(stderr, stderrTail)
+	ignoreTerminalSignals(s.cmd)
+	err = s.cmd.Start()
+	if err != nil {
+		err = errors.Wrap(err, "failed to start BluBracket CLI process")
+		s = nil
+		return
+	}
+	go func() {
+		waitErr := s.cmd.Wait()
+		stdout.flush()
+		stderr.flush()
+		s.exitErr = errors.Errorf("BluBracket CLI process exited (%v). stderr: %s", exitStatus(waitErr), stderrTail)
+		s.exited <- s.exitErr
+		close(s.done)
+	}()
+	// establish a connection once the server is ready
+	conn, err = connectToServer(ctx, serverUri, insecure.NewCredentials(), serverStartTimeout, s.exited)
+	if err != nil {
+		s.stop()
+		s = nil
+	}
+	return
+}
+
+// exitError waits up to timeout for the process to exit and returns how it exited,
+// or nil if it is still running
+func (s *cliServer) exitError(timeout time.Duration) error {
+	select {
+	case <-s.done:
+		return s.exitErr
+	case <-time.After(timeout):
+		return nil
+	}
+}
+
+// stop asks the process to exit, kills it if it does not exit in time and removes its socket.
+func (s *cliServer) stop() {
+	terminate(s.cmd.Process)
+	select {
+	case <-s.done:
+	case <-time.After(cliStopTimeout):
+		s.cmd.Process.Kill()
+		<-s.done
+	}
+	os.Remove(s.socket)
+}
+
+// exitStatus describes how a process exited from the error returned by its Wait
+func exitStatus(waitErr error) string {
+	if waitErr == nil {
+		return "exit status 0"
+	}
+	return waitErr.Error()
+}
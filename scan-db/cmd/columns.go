@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// columnComment reads the comment of the column in the table from the database catalog.
+// it returns an empty comment if the column has none or the database does not support comments.
+func columnComment(db *gorm.DB, table, column string) (comment string, err error) {
+	var q string
+	var args []interface{}
+	switch dbType {
+	case dbTypeEnum(dbTypePostgres):
+		q = `SELECT col_description(a.attrelid, a.attnum) FROM pg_attribute a
+		WHERE a.attrelid = to_regclass(?) AND a.attname = ?`
+		args = []interface{}{table, column}
+	case dbTypeEnum(dbTypeSqlite):
+		// sqlite has no column comments
+		return
+	case dbTypeEnum(dbTypeMysql):
+		q = `SELECT COLUMN_COMMENT FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?`
+		args = []interface{}{table, column}
+	case dbTypeEnum(dbTypeMssql):
+		q = `SELECT CAST(value AS nvarchar(max)) FROM sys.extended_properties
+		WHERE class = 1 AND name = 'MS_Description' AND major_id = OBJECT_ID(?)
+		AND minor_id = COLUMNPROPERTY(OBJECT_ID(?), ?, 'ColumnId')`
+		args = []interface{}{table, table, column}
+	default:
+		// should not get here
+		panic(fmt.Sprintf("unknown dbtype : %v", dbType))
+	}
+	var c sql.NullString
+	err = db.Raw(q, args...).Row().Scan(&c)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	if err != nil {
+		err = errors.Wrapf(err, "failed to read comment of column %s.%s", table, column)
+		return
+	}
+	comment = c.String
+	return
+}
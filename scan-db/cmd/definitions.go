@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// definition query parts per database.
+// each part selects two columns - the record id formatted as '<object type>:<schema>.<name>'
+// and the definition text of the object. parts are combined with UNION ALL.
+// the definition is scanned as is, so line numbers in the risks found are relative to the definition.
+var (
+	postgresDefinitionQueries = []string{
+		// functions and procedures
+		`SELECT (CASE p.prokind WHEN 'p' THEN 'procedure' ELSE 'function' END) || ':' || n.nspname || '.' || p.proname, p.prosrc
+		FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace
+		WHERE n.nspname NOT IN ('pg_catalog', 'information_schema') AND p.prolang NOT IN (SELECT oid FROM pg_language WHERE lanname IN ('c', 'internal'))`,
+		// views
+		`SELECT 'view:' || schemaname || '.' || viewname, definition
+		FROM pg_views WHERE schemaname NOT IN ('pg_catalog', 'information_schema')`,
+		// triggers
+		`SELECT 'trigger:' || n.nspname || '.' || t.tgname, pg_get_triggerdef(t.oid)
+		FROM pg_trigger t JOIN pg_class c ON c.oid = t.tgrelid JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE NOT t.tgisinternal`,
+		// column defaults
+		`SELECT 'default:' || n.nspname || '.' || c.relname || '.' || a.attname, pg_get_expr(d.adbin, d.adrelid)
+		FROM pg_attrdef d JOIN pg_class c ON c.oid = d.adrelid JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_attribute a ON a.attrelid = d.adrelid AND a.attnum = d.adnum
+		WHERE n.nspname NOT IN ('pg_catalog', 'information_schema')`,
+		// table and column comments
+		`SELECT 'comment:' || n.nspname || '.' || c.relname || COALESCE('.' || a.attname, ''), d.description
+		FROM pg_description d JOIN pg_class c ON c.oid = d.objoid AND d.classoid = 'pg_class'::regclass
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum = d.objsubid AND d.objsubid > 0
+		WHERE n.nspname NOT IN ('pg_catalog', 'information_schema')`,
+		// function and procedure comments
+		`SELECT 'comment:' || n.nspname || '.' || p.proname, d.description
+		FROM pg_description d JOIN pg_proc p ON p.oid = d.objoid AND d.classoid = 'pg_proc'::regclass
+		JOIN pg_namespace n ON n.oid = p.pronamespace
+		WHERE n.nspname NOT IN ('pg_catalog', 'information_schema')`,
+	}
+
+	mysqlSystemSchemas = `('mysql', 'sys', 'information_schema', 'performance_schema')`
+
+	mysqlDefinitionQueries = []string{
+		// functions and procedures
+		`SELECT CONCAT(LOWER(ROUTINE_TYPE), ':', ROUTINE_SCHEMA, '.', ROUTINE_NAME), ROUTINE_DEFINITION
+		FROM information_schema.ROUTINES WHERE ROUTINE_SCHEMA NOT IN ` + mysqlSystemSchemas,
+		// views
+		`SELECT CONCAT('view:', TABLE_SCHEMA, '.', TABLE_NAME), VIEW_DEFINITION
+		FROM information_schema.VIEWS WHERE TABLE_SCHEMA NOT IN ` + mysqlSystemSchemas,
+		// triggers
+		`SELECT CONCAT('trigger:', TRIGGER_SCHEMA, '.', TRIGGER_NAME), ACTION_STATEMENT
+		FROM information_schema.TRIGGERS WHERE TRIGGER_SCHEMA NOT IN ` + mysqlSystemSchemas,
+		// scheduled events
+		`SELECT CONCAT('event:', EVENT_SCHEMA, '.', EVENT_NAME), EVENT_DEFINITION
+		FROM information_schema.EVENTS WHERE EVENT_SCHEMA NOT IN ` + mysqlSystemSchemas,
+		// column defaults
+		`SELECT CONCAT('default:', TABLE_SCHEMA, '.', TABLE_NAME, '.', COLUMN_NAME), COLUMN_DEFAULT
+		FROM information_schema.COLUMNS WHERE COLUMN_DEFAULT IS NOT NULL AND TABLE_SCHEMA NOT IN ` + mysqlSystemSchemas,
+		// table, column and routine comments
+		`SELECT CONCAT('comment:', TABLE_SCHEMA, '.', TABLE_NAME), TABLE_COMMENT
+		FROM information_schema.TABLES WHERE TABLE_COMMENT <> '' AND TABLE_SCHEMA NOT IN ` + mysqlSystemSchemas,
+		`SELECT CONCAT('comment:', TABLE_SCHEMA, '.', TABLE_NAME, '.', COLUMN_NAME), COLUMN_COMMENT
+		FROM information_schema.COLUMNS WHERE COLUMN_COMMENT <> '' AND TABLE_SCHEMA NOT IN ` + mysqlSystemSchemas,
+		`SELECT CONCAT('comment:', ROUTINE_SCHEMA, '.', ROUTINE_NAME), ROUTINE_COMMENT
+		FROM information_schema.ROUTINES WHERE ROUTINE_COMMENT <> '' AND ROUTINE_SCHEMA NOT IN ` + mysqlSystemSchemas,
+	}
+
+	mssqlDefinitionQueries = []string{
+		// procedures, functions, views and triggers
+		`SELECT (CASE WHEN o.type IN ('P', 'PC', 'RF', 'X') THEN 'procedure'
+			WHEN o.type IN ('FN', 'IF', 'TF', 'FS', 'FT') THEN 'function'
+			WHEN o.type = 'V' THEN 'view'
+			WHEN o.type IN ('TR', 'TA') THEN 'trigger'
+			ELSE LOWER(o.type_desc) END) + ':' + s.name + '.' + o.name, m.definition
+		FROM sys.sql_modules m JOIN sys.objects o ON o.object_id = m.object_id JOIN sys.schemas s ON s.schema_id = o.schema_id
+		WHERE o.is_ms_shipped = 0`,
+		// database level triggers
+		`SELECT 'trigger:database.' + t.name, m.definition
+		FROM sys.triggers t JOIN sys.sql_modules m ON m.object_id = t.object_id WHERE t.parent_class = 0`,
+		// column defaults
+		`SELECT 'default:' + s.name + '.' + t.name + '.' + c.name, d.definition
+		FROM sys.default_constraints d JOIN sys.tables t ON t.object_id = d.parent_object_id
+		JOIN sys.columns c ON c.object_id = d.parent_object_id AND c.column_id = d.parent_column_id
+		JOIN sys.schemas s ON s.schema_id = t.schema_id`,
+		// object and column comments (extended properties). the property name is kept in the text, e.g. 'MS_Description: ...'
+		`SELECT 'comment:' + s.name + '.' + o.name + COALESCE('.' + c.name, ''), ep.name + ': ' + CAST(ep.value AS nvarchar(max))
+		FROM sys.extended_properties ep JOIN sys.objects o ON o.object_id = ep.major_id
+		JOIN sys.schemas s ON s.schema_id = o.schema_id
+		LEFT JOIN sys.columns c ON c.object_id = ep.major_id AND c.column_id = ep.minor_id AND ep.minor_id > 0
+		WHERE ep.class = 1`,
+	}
+
+	// sqlite keeps the original create statement of each object. table statements include
+	// column defaults and comments.
+	sqliteDefinitionQueries = []string{
+		`SELECT type || ':main.' || name, sql FROM sqlite_master WHERE sql IS NOT NULL`,
+	}
+)
+
+// definitionsQuery returns the query to select definitions of code objects like procedures, functions,
+// triggers, views and defaults from the database catalog.
+// the query returns the record id and the definition for each object.
+func definitionsQuery() string {
+	var parts []string
+	switch dbType {
+	case dbTypeEnum(dbTypePostgres):
+		parts = postgresDefinitionQueries
+	case dbTypeEnum(dbTypeSqlite):
+		parts = sqliteDefinitionQueries
+	case dbTypeEnum(dbTypeMysql):
+		parts = mysqlDefinitionQueries
+	case dbTypeEnum(dbTypeMssql):
+		parts = mssqlDefinitionQueries
+	default:
+		// should not get here
+		panic(fmt.Sprintf("unknown dbtype : %v", dbType))
+	}
+	return strings.Join(parts, "\nUNION ALL\n")
+}
@@ -0,0 +1,233 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	pb "github.com/BluBracket/database-risk-scanner/grpc/api"
+	"github.com/BluBracket/database-risk-scanner/scan-db/detect"
+	"github.com/BluBracket/database-risk-scanner/scan-db/engine"
+	"github.com/bserdar/jsonstream"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// detectorOptions holds the configuration of the in-process detectors loaded from the flags
+type detectorOptions struct {
+	// customRules are loaded from the '--rules' file
+	customRules engine.Rules
+	// entropy holds the entropy thresholds, if '--entropy' flag is given
+	entropy engine.EntropyConfig
+	// columnComments holds the comments of the scanned columns, if '--column-semantics' flag is given
+	columnComments map[string]string
+	// hashAudit audits the password hashes, if '--hash-audit' flag is given
+	hashAudit *engine.HashAudit
+}
+
+// loadDetectorOptions loads the configuration of the in-process detectors enabled by the flags.
+func loadDetectorOptions() (opts detectorOptions, err error) {
+	if rulesPath != "" {
+		opts.customRules, err = engine.LoadRules(rulesPath)
+		if err != nil {
+			return
+		}
+	}
+	if hashAudit {
+		opts.hashAudit = engine.NewHashAudit(minBcryptCost)
+	}
+	if detectEntropy {
+		opts.entropy, err = entropyConfig()
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// loadColumnComments reads the comments of the scanned column for the column semantics detector.
+// comments can not always be read (e.g. missing privileges), so failure is reported but not fatal.
+func (opts *detectorOptions) loadColumnComments(db *gorm.DB) {
+	if !columnSemantics {
+		return
+	}
+	opts.columnComments = map[string]string{}
+	if scanDefinitions {
+		return
+	}
+	comment, err := columnComment(db, table, column)
+	if err != nil {
+		logger.warn("column semantics uses column name only", "error", err)
+		return
+	}
+	opts.columnComments[column] = comment
+}
+
+// entropyConfig returns the default entropy thresholds overridden by '--entropy-threshold'
+// and '--entropy-min-length' flags.
+func entropyConfig() (config engine.EntropyConfig, err error) {
+	config = engine.DefaultEntropyConfig()
+	for alphabet, v := range entropyThresholds {
+		t, ok := config[alphabet]
+		if !ok {
+			err = unsupportedAlphabet(alphabet)
+			return
+		}
+		t.MinEntropy, err = strconv.ParseFloat(v, 64)
+		if err != nil {
+			err = errors.Wrapf(err, "invalid entropy threshold for %s", alphabet)
+			return
+		}
+		config[alphabet] = t
+	}
+	for alphabet, v := range entropyMinLengths {
+		t, ok := config[alphabet]
+		if !ok {
+			err = unsupportedAlphabet(alphabet)
+			return
+		}
+		t.MinLength = v
+		config[alphabet] = t
+	}
+	return
+}
+
+func unsupportedAlphabet(alphabet string) error {
+	return errors.New(fmt.Sprintf("Unsupported entropy alphabet : %s. Supported alphabets are (%s)",
+		alphabet, supportedAlphabetsText))
+}
+
+// rulesAnalyzer runs the custom rules which apply to the column of the record,
+// or to its key in key/value mode. in row document mode, the rules which apply to a column
+// run on its value.
+type rulesAnalyzer struct {
+	rules engine.Rules
+}
+
+func (a rulesAnalyzer) Analyze(r detect.Record) (risks []*pb.Risk, err error) {
+	if r.Key != "" {
+		return a.rules.ForColumn(r.Key).Scan(r.Data), nil
+	}
+	if len(r.Fields) > 0 {
+		for i, f := range r.Fields {
+			for _, risk := range a.rules.ForColumn(f.Name).Scan(f.Value) {
+				rowDocumentRisk(risk, i, f.Name)
+				risks = append(risks, risk)
+			}
+		}
+		return
+	}
+	return a.rules.ForColumn(r.Column).Scan(r.Data), nil
+}
+
+// piiAnalyzer finds validated PII
+var piiAnalyzer = detect.AnalyzerFunc(func(r detect.Record) ([]*pb.Risk, error) {
+	return engine.ScanPII(r.Data), nil
+})
+
+// entropyAnalyzer finds high-randomness strings
+type entropyAnalyzer struct {
+	config engine.EntropyConfig
+}
+
+func (a entropyAnalyzer) Analyze(r detect.Record) ([]*pb.Risk, error) {
+	return engine.ScanEntropy(r.Data, a.config), nil
+}
+
+// credentialAnalyzer finds plaintext values in columns holding credentials,
+// identified by the column name and comment.
+type credentialAnalyzer struct {
+	comments map[string]string
+}
+
+func (a credentialAnalyzer) Analyze(r detect.Record) ([]*pb.Risk, error) {
+	return engine.ScanPlaintextCredential(r.Column, a.comments[r.Column], r.Data), nil
+}
+
+// keyAnalyzer finds plaintext values stored under keys holding credentials in key/value mode
+var keyAnalyzer = detect.AnalyzerFunc(func(r detect.Record) ([]*pb.Risk, error) {
+	return engine.ScanKeyedCredential(r.Key, r.Data), nil
+})
+
+// hashAuditDetector audits the password hashes of the records.
+// weak hashes are reported when submitted, duplicates on close.
+type hashAuditDetector struct {
+	audit   *engine.HashAudit
+	handler detect.Handler
+}
+
+func (d hashAuditDetector) Submit(r detect.Record) (err error) {
+	for _, risk := range d.audit.Add(r.Id, r.Data) {
+		err = d.handler(detect.Finding{RecordId: r.Id, Risk: risk})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (d hashAuditDetector) Close() (err error) {
+	duplicates := d.audit.Duplicates()
+	ids := make([]string, 0, len(duplicates))
+	for id := range duplicates {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		for _, risk := range duplicates[id] {
+			err = d.handler(detect.Finding{RecordId: id, Risk: risk})
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// writeHashSummary writes the summary of the hash audit of the column to the output in json format
+// and prints it.
+func writeHashSummary(audit *engine.HashAudit, out jsonstream.LineWriter) (err error) {
+	summary := audit.Summary()
+	err = out.Marshal(map[string]interface{}{
+		"Table":     table,
+		"Column":    column,
+		"HashAudit": summary,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "failed writing hash audit summary to output")
+		return
+	}
+	logger.info("hash audit", "table", table, "column", column, "values", summary.Total, "weak", summary.Weak,
+		"weak_percent", fmt.Sprintf("%.2f", summary.WeakPercent), "duplicates", summary.Duplicates, "algorithms", summary.Algorithms)
+	return
+}
+
+// withDetectors adds the in-process detectors enabled by the flags to the engine detector d.
+// risks found by all the detectors are reported to the handler.
+// custom rules report the rule name in the tags, correlated risks of a row document the participating columns.
+// records are accounted as sent before any detector takes them, so the risks of all the detectors are accounted.
+func withDetectors(d detect.Detector, opts detectorOptions, h detect.Handler) detect.Detector {
+	detectors := []detect.Detector{detect.Accounted(d, recordAccounting)}
+	if len(opts.customRules) > 0 {
+		detectors = append(detectors, detect.FromAnalyzer(rulesAnalyzer{rules: opts.customRules}, h))
+	}
+	if detectPII {
+		detectors = append(detectors, detect.FromAnalyzer(piiAnalyzer, h))
+	}
+	if opts.entropy != nil {
+		detectors = append(detectors, detect.FromAnalyzer(entropyAnalyzer{config: opts.entropy}, h))
+	}
+	if opts.columnComments != nil {
+		detectors = append(detectors, detect.FromAnalyzer(credentialAnalyzer{comments: opts.columnComments}, h))
+	}
+	if len(rowColumns) > 0 {
+		detectors = append(detectors, detect.FromAnalyzer(correlationAnalyzer, h))
+	}
+	if keyColumn != "" {
+		detectors = append(detectors, detect.FromAnalyzer(keyAnalyzer, h))
+	}
+	if opts.hashAudit != nil {
+		detectors = append(detectors, hashAuditDetector{audit: opts.hashAudit, handler: h})
+	}
+	return detect.Multi(detectors...)
+}
@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// defaultMinEngineVersion is the minimum supported BluBracket CLI version, i.e. the first version with 'serve'
+const defaultMinEngineVersion = "1.0.0"
+
+// versionTimeout bounds the run of the BluBracket CLI to read its version
+const versionTimeout = 10 * time.Second
+
+// proxyVariables are removed from the environment of the BluBracket CLI, so the scanned data can not be sent
+// off the machine through a proxy
+var proxyVariables = []string{"HTTP_PROXY", "HTTPS_PROXY", "ALL_PROXY", "FTP_PROXY", "NO_PROXY", "GRPC_PROXY"}
+
+// semver matches a major.minor.patch version
+var semver = regexp.MustCompile(`(\d+)\.(\d+)\.(\d+)`)
+
+// resolveEngineBinary returns the path of the BluBracket CLI given by '--engine-path' flag, else found in PATH.
+// the binary is checked against '--engine-sha256' pin and '--engine-min-version'.
+func resolveEngineBinary() (path string, err error) {
+	path = enginePath
+	if path == "" {
+		path = blubracketProcessName
+	}
+	path, err = exec.LookPath(path)
+	if err != nil {
+		err = errors.Wrap(err, "failed to find BluBracket CLI")
+		return
+	}
+	err = verifyEngineDigest(path)
+	if err != nil {
+		return
+	}
+	err = checkEngineVersion(path)
+	return
+}
+
+// verifyEngineDigest checks that the sha256 of the binary is the '--engine-sha256' pin, if given,
+// so a tampered executable does not receive the scanned data.
+func verifyEngineDigest(path string) (err error) {
+	if engineSha256 == "" {
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		err = errors.Wrap(err, "failed to open BluBracket CLI binary")
+		return
+	}
+	defer f.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		err = errors.Wrap(err, "failed to read BluBracket CLI binary")
+		return
+	}
+	digest := hex.EncodeToString(h.Sum(nil))
+	if !strings.EqualFold(digest, engineSha256) {
+		err = errors.New(fmt.Sprintf("sha256 of BluBracket CLI binary %s is %s, not the --engine-sha256 pin", path, digest))
+	}
+	return
+}
+
+// checkEngineVersion runs the binary with --version and checks the first major.minor.patch of the output
+// is at least '--engine-min-version'. an empty minimum version turns the check off.
+func checkEngineVersion(path string) (err error) {
+	if engineMinVersion == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), versionTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path, "--version")
+	cmd.Env = engineEnv()
+	out, err := cmd.Output()
+	if err != nil {
+		err = errors.Wrap(err, "failed to read BluBracket CLI version")
+		return
+	}
+	version := semver.FindString(string(out))
+	if version == "" {
+		err = errors.New(fmt.Sprintf("failed to read BluBracket CLI version from '%s'", strings.TrimSpace(string(out))))
+		return
+	}
+	if compareVersions(version, engineMinVersion) < 0 {
+		err = errors.New(fmt.Sprintf("BluBracket CLI version %s is older than the minimum supported version %s",
+			version, engineMinVersion))
+		return
+	}
+	logger.info("BluBracket CLI version", "version", version)
+	return
+}
+
+// compareVersions compares major.minor.patch versions. it returns -1, 0 or 1 if a is older, the same or newer than b.
+func compareVersions(a, b string) int {
+	va, vb := semver.FindStringSubmatch(a), semver.FindStringSubmatch(b)
+	for i := 1; i <= 3; i++ {
+		x, _ := strconv.Atoi(va[i])
+		y, _ := strconv.Atoi(vb[i])
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+// engineEnv returns the environment of the BluBracket CLI: the environment of scan-db without the proxy
+// variables, with the '--engine-env' variables.
+func engineEnv() (env []string) {
+	for _, kv := range os.Environ() {
+		name := strings.SplitN(kv, "=", 2)[0]
+		if isProxyVariable(name) {
+			continue
+		}
+		if _, ok := engineEnvVars[name]; ok {
+			continue
+		}
+		env = append(env, kv)
+	}
+	for name, value := range engineEnvVars {
+		env = append(env, name+"="+value)
+	}
+	return
+}
+
+func isProxyVariable(name string) bool {
+	for _, p := range proxyVariables {
+		if strings.EqualFold(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateEngineFlags checks the flags of the BluBracket CLI
+func validateEngineFlags() (err error) {
+	if engineMinVersion != "" && !semver.MatchString(engineMinVersion) {
+		return errors.New("invalid --engine-min-version " + engineMinVersion + ". expected major.minor.patch")
+	}
+	if engineSha256 != "" {
+		if b, decodeErr := hex.DecodeString(engineSha256); decodeErr != nil || len(b) != sha256.Size {
+			return errors.New("invalid --engine-sha256. expected hex sha256 of the BluBracket CLI binary")
+		}
+	}
+	return
+}
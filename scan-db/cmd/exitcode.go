@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	pb "github.com/BluBracket/database-risk-scanner/grpc/api"
+	"github.com/BluBracket/database-risk-scanner/scan-db/engine"
+	"github.com/pkg/errors"
+)
+
+// exit codes of scan-db
+const (
+	// exitClean is returned when the scan completed without risks at or above '--fail-on' severity
+	exitClean = 0
+	// exitFindings is returned when risks at or above '--fail-on' severity were found
+	exitFindings = 1
+	// exitError is returned when the scan failed before scanning any record, or for invalid flags
+	exitError = 2
+	// exitPartial is returned when the scan did not complete, so the output holds partial results
+	exitPartial = 3
+)
+
+var (
+	// exitCode is the exit code of the command run
+	exitCode = exitClean
+	// partialScan is set when the scan did not cover all the data, e.g. it failed after scanning some records
+	partialScan = false
+	// count of risks at or above '--fail-on' severity
+	failingCount counter
+	// count of risks dropped by '--min-severity' and '--category' filters
+	filteredCount counter
+)
+
+var exitCodesText = `Exit codes:
+  0  scan completed, no risks at or above --fail-on severity
+  1  risks at or above --fail-on severity found
+  2  scan error, or invalid flags
+  3  partial scan, e.g. the scan failed after some records were scanned
+`
+
+// validateFilterFlags checks the severity and category filter flags
+func validateFilterFlags() (err error) {
+	for _, f := range []struct{ name, value string }{{"fail-on", failOn}, {"min-severity", minSeverity}} {
+		if f.value != "" && engine.SeverityRank(f.value) < 0 {
+			return errors.New(fmt.Sprintf("Unsupported --%s severity : %s. Supported severities are (%s)",
+				f.name, f.value, strings.Join(engine.Severities, ", ")))
+		}
+	}
+	return
+}
+
+// filtered tells if the risk is dropped by '--min-severity' and '--category' filters.
+// risks with unknown severity are not dropped by severity.
+func filtered(risk *pb.Risk) bool {
+	if minSeverity != "" {
+		rank := engine.SeverityRank(risk.Severity)
+		if rank >= 0 && rank < engine.SeverityRank(minSeverity) {
+			return true
+		}
+	}
+	if len(categories) > 0 {
+		for _, c := range categories {
+			if strings.EqualFold(c, risk.Category) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// failing tells if the risk is at or above '--fail-on' severity
+func failing(risk *pb.Risk) bool {
+	return failOn != "" && engine.SeverityRank(risk.Severity) >= engine.SeverityRank(failOn)
+}
+
+// resultExitCode prints the error, if any, and returns the exit code for the result of the command.
+func resultExitCode(err error) int {
+	if err != nil {
+		logger.error(err.Error())
+		if partialScan {
+			return exitPartial
+		}
+		return exitError
+	}
+	if failingCount.get() > 0 {
+		logger.warn("risks at or above --fail-on severity found", "count", failingCount.get(), "severity", failOn)
+		return exitFindings
+	}
+	if partialScan {
+		return exitPartial
+	}
+	return exitClean
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// drainTimeout is how long the risks of the records in flight are waited for once the scan is interrupted
+const drainTimeout = 30 * time.Second
+
+// errInterrupted is returned when the scan is stopped by SIGINT or SIGTERM
+var errInterrupted = errors.New("scan interrupted")
+
+// handleSignals stops the scan gracefully on SIGINT or SIGTERM.
+// scanCtx is cancelled on the first signal: no more rows are read, and the records in flight are finished.
+// streamCtx, used for the detection streams, is cancelled on a second signal or after drainTimeout,
+// which aborts the records in flight.
+// release stops handling the signals.
+func handleSignals() (scanCtx, streamCtx context.Context, release func()) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	scanCtx, stopScan := context.WithCancel(context.Background())
+	streamCtx, abort := context.WithCancel(context.Background())
+	released := make(chan struct{})
+	go func() {
+		select {
+		case s := <-signals:
+			logger.warn("finishing the records in flight. send the signal again to abort", "signal", s)
+			stopScan()
+		case <-released:
+			return
+		}
+		select {
+		case <-signals:
+			logger.warn("aborting the records in flight")
+		case <-time.After(drainTimeout):
+			logger.warn("records in flight not finished. aborting them", "timeout", drainTimeout)
+		case <-released:
+			return
+		}
+		abort()
+	}()
+	release = func() {
+		signal.Stop(signals)
+		close(released)
+		stopScan()
+		abort()
+	}
+	return
+}
+
+// checkpoint records how far an interrupted scan went
+type checkpoint struct {
+	Table  string
+	Column string
+	// RecordsScanned is the number of records read before the interruption
+	RecordsScanned int
+	// LastRecordId is the id of the last record read. records of a table are read in the order of the id column,
+	// then of the key column, so the records up to it were read.
+	// definitions are read in no particular order, their last record id is a progress marker only.
+	LastRecordId string
+	Interrupted  time.Time
+}
+
+// checkpointPath returns the file the checkpoint of an interrupted scan is written to:
+// the '--checkpoint' file, else the output file with .checkpoint extension.
+// it is empty if the output is stdout, then the checkpoint is printed only.
+func checkpointPath() string {
+	if checkpointFile != "" || output == "" {
+		return checkpointFile
+	}
+	return output + ".checkpoint"
+}
+
+// writeCheckpoint writes the checkpoint of the interrupted scan in json format and prints it
+func writeCheckpoint(lastRecordId string) (err error) {
+	c := checkpoint{
+		Table:          table,
+		Column:         column,
+		RecordsScanned: scannedCount.get(),
+		LastRecordId:   lastRecordId,
+		Interrupted:    time.Now().UTC(),
+	}
+	logger.info("scan interrupted", "records_scanned", c.RecordsScanned, "last_record_id", c.LastRecordId)
+	path := checkpointPath()
+	if path == "" {
+		return
+	}
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return
+	}
+	err = os.WriteFile(path, b, 0644)
+	if err != nil {
+		err = errors.Wrap(err, "failed to write checkpoint")
+		return
+	}
+	logger.info("checkpoint written", "path", path)
+	return
+}
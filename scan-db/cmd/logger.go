@@ -0,0 +1,275 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// structuredLogger writes levelled diagnostics with key/value fields, in text (logfmt) or json format.
+// it writes to stderr, so stdout is left to the findings. it is safe for concurrent use.
+type structuredLogger struct {
+	mu     sync.Mutex
+	w      io.Writer
+	level  logLevelEnum
+	format logFormatEnum
+}
+
+// logger is the logger of scan-db, configured by '--log-level' and '--log-format' flags
+var logger = &structuredLogger{w: os.Stderr, level: logLevelEnum(logLevelInfo), format: logFormatEnum(logFormatText)}
+
+// logTimeFormat is the format of the time of a log entry
+const logTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+func (l *structuredLogger) debug(msg string, keyvals ...interface{}) {
+	l.log(logLevelDebug, msg, keyvals)
+}
+
+func (l *structuredLogger) info(msg string, keyvals ...interface{}) {
+	l.log(logLevelInfo, msg, keyvals)
+}
+
+func (l *structuredLogger) warn(msg string, keyvals ...interface{}) {
+	l.log(logLevelWarn, msg, keyvals)
+}
+
+func (l *structuredLogger) error(msg string, keyvals ...interface{}) {
+	l.log(logLevelError, msg, keyvals)
+}
+
+// log writes an entry with the message and the fields given as key, value pairs if the level is enabled
+func (l *structuredLogger) log(level string, msg string, keyvals []interface{}) {
+	if logLevelRank(level) < logLevelRank(string(l.level)) {
+		return
+	}
+	var b bytes.Buffer
+	if l.format == logFormatEnum(logFormatJson) {
+		writeJsonEntry(&b, level, msg, keyvals)
+	} else {
+		writeTextEntry(&b, level, msg, keyvals)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(b.Bytes())
+}
+
+// writeTextEntry writes the entry as a logfmt line: time=... level=... msg=... key=value...
+func writeTextEntry(b *bytes.Buffer, level string, msg string, keyvals []interface{}) {
+	fmt.Fprintf(b, "time=%s level=%s msg=%s", time.Now().Format(logTimeFormat), level, quoteLogValue(msg))
+	for i := 0; i < len(keyvals); i += 2 {
+		fmt.Fprintf(b, " %v=%s", keyvals[i], quoteLogValue(logValueText(logValue(keyvals, i+1))))
+	}
+	b.WriteByte('\n')
+}
+
+// writeJsonEntry writes the entry as a json object on a line, with the fields in the given order
+func writeJsonEntry(b *bytes.Buffer, level string, msg string, keyvals []interface{}) {
+	fmt.Fprintf(b, `{"time":%q,"level":%q,"msg":%s`, time.Now().Format(logTimeFormat), level, jsonLogValue(msg))
+	for i := 0; i < len(keyvals); i += 2 {
+		fmt.Fprintf(b, ",%s:%s", jsonLogValue(fmt.Sprint(keyvals[i])), jsonLogValue(logValue(keyvals, i+1)))
+	}
+	b.WriteString("}\n")
+}
+
+// logValue returns the value of the i-th key/value item, nil if missing
+func logValue(keyvals []interface{}, i int) interface{} {
+	if i < len(keyvals) {
+		return keyvals[i]
+	}
+	return nil
+}
+
+// logValueText formats a field value as text
+func logValueText(v interface{}) string {
+	switch v := v.(type) {
+	case []string:
+		return strings.Join(v, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// quoteLogValue quotes a text value if it is empty or holds spaces, quotes, '=' or control characters
+func quoteLogValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " \"=\t\r\n") || strconv.Quote(s) != `"`+s+`"` {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// jsonLogValue encodes a field value as json. errors and durations are encoded as text.
+func jsonLogValue(v interface{}) []byte {
+	switch t := v.(type) {
+	case error:
+		v = t.Error()
+	case time.Duration:
+		v = t.String()
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprint(v))
+	}
+	return b
+}
+
+// lineLogger is an io.Writer logging each line written as an entry with the fields,
+// e.g. to capture the output of the engine process.
+type lineLogger struct {
+	mu      sync.Mutex
+	keyvals []interface{}
+	buf     []byte
+}
+
+func newLineLogger(keyvals ...interface{}) *lineLogger {
+	return &lineLogger{keyvals: keyvals}
+}
+
+func (l *lineLogger) Write(p []byte) (n int, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		l.logLine(l.buf[:i])
+		l.buf = l.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush logs the last line if it is not terminated
+func (l *lineLogger) flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.buf) > 0 {
+		l.logLine(l.buf)
+		l.buf = nil
+	}
+}
+
+func (l *lineLogger) logLine(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if len(line) == 0 {
+		return
+	}
+	logger.info(string(line), l.keyvals...)
+}
+
+// slowQueryThreshold is the duration of a query logged as slow
+const slowQueryThreshold = 10 * time.Second
+
+// gormLogger logs the diagnostics of gorm with logger, so they do not go to stdout with the findings.
+// query errors are returned and reported by scan-db, so they are logged at debug level only.
+type gormLogger struct{}
+
+func (l gormLogger) LogMode(gormlogger.LogLevel) gormlogger.Interface {
+	return l
+}
+
+func (gormLogger) Info(_ context.Context, msg string, args ...interface{}) {
+	logger.debug(fmt.Sprintf(msg, args...))
+}
+
+func (gormLogger) Warn(_ context.Context, msg string, args ...interface{}) {
+	logger.warn(fmt.Sprintf(msg, args...))
+}
+
+func (gormLogger) Error(_ context.Context, msg string, args ...interface{}) {
+	logger.debug(fmt.Sprintf(msg, args...))
+}
+
+func (gormLogger) Trace(_ context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	elapsed := time.Since(begin)
+	sql, _ := fc()
+	switch {
+	case err != nil:
+		logger.debug("query failed", "sql", sql, "error", err, "duration", elapsed)
+	case elapsed > slowQueryThreshold:
+		logger.warn("slow query", "sql", sql, "duration", elapsed)
+	default:
+		logger.debug("query", "sql", sql, "duration", elapsed)
+	}
+}
+
+// logLevelEnum is custom value type and implements pFlag.Value interface
+type logLevelEnum string
+
+const (
+	logLevelDebug string = "debug"
+	logLevelInfo  string = "info"
+	logLevelWarn  string = "warn"
+	logLevelError string = "error"
+)
+
+var supportedLogLevels = []string{logLevelDebug, logLevelInfo, logLevelWarn, logLevelError}
+var supportedLogLevelsText = strings.Join(supportedLogLevels, ", ")
+
+// logLevelRank orders the log levels from debug to error
+func logLevelRank(level string) int {
+	for i, l := range supportedLogLevels {
+		if l == level {
+			return i
+		}
+	}
+	return 0
+}
+
+func (t *logLevelEnum) String() string {
+	return string(*t)
+}
+
+func (t *logLevelEnum) Type() string {
+	return "logLevelEnum"
+}
+
+func (t *logLevelEnum) Set(v string) error {
+	switch v {
+	case logLevelDebug, logLevelInfo, logLevelWarn, logLevelError:
+		*t = logLevelEnum(v)
+		return nil
+	default:
+		return errors.New(fmt.Sprintf("Unsupported log level : %s. Supported log levels are (%s)",
+			v, supportedLogLevelsText))
+	}
+}
+
+// logFormatEnum is custom value type and implements pFlag.Value interface
+type logFormatEnum string
+
+const (
+	logFormatText string = "text"
+	logFormatJson string = "json"
+)
+
+var supportedLogFormatsText = strings.Join([]string{logFormatText, logFormatJson}, ", ")
+
+func (t *logFormatEnum) String() string {
+	return string(*t)
+}
+
+func (t *logFormatEnum) Type() string {
+	return "logFormatEnum"
+}
+
+func (t *logFormatEnum) Set(v string) error {
+	switch v {
+	case logFormatText, logFormatJson:
+		*t = logFormatEnum(v)
+		return nil
+	default:
+		return errors.New(fmt.Sprintf("Unsupported log format : %s. Supported log formats are (%s)",
+			v, supportedLogFormatsText))
+	}
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"context"
+	"net"
+
+	pb "github.com/BluBracket/database-risk-scanner/grpc/api"
+	"github.com/BluBracket/database-risk-scanner/scan-db/engine"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// startNativeServer starts the native detection engine as an in-process gRPC server
+// listening on an in-memory connection and establishes a connection to it.
+// streams are served concurrently. stop stops the server.
+func startNativeServer() (conn *grpc.ClientConn, stop func(), err error) {
+	logger.info("starting native detection engine")
+	const bufSize = 1024 * 1024
+	listener := bufconn.Listen(bufSize)
+	server := grpc.NewServer()
+	pb.RegisterBluBracketServer(server, engine.NewServer(engine.DefaultRules()))
+	go server.Serve(listener)
+
+	conn, err = grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		server.Stop()
+		err = errors.Wrap(err, "failed to connect to native engine")
+		return
+	}
+	stop = server.Stop
+	return
+}
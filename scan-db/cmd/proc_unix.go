@@ -0,0 +1,21 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// ignoreTerminalSignals starts the process in its own process group,
+// so Ctrl-C in the terminal signals scan-db only.
+func ignoreTerminalSignals(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// terminate asks the process to exit
+func terminate(p *os.Process) {
+	p.Signal(syscall.SIGTERM)
+}
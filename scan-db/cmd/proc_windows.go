@@ -0,0 +1,21 @@
+//go:build windows
+// +build windows
+
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// ignoreTerminalSignals starts the process in a new process group,
+// so Ctrl-C in the console signals scan-db only.
+func ignoreTerminalSignals(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// terminate stops the process. windows has no signal to ask a process to exit, so it is killed.
+func terminate(p *os.Process) {
+	p.Kill()
+}
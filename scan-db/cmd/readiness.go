@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/BluBracket/database-risk-scanner/grpc/api"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// firstProbeDelay is the wait before the second readiness probe. it doubles up to maxProbeDelay.
+	firstProbeDelay = 50 * time.Millisecond
+	maxProbeDelay   = time.Second
+	// maxDialTimeout bounds a single dial attempt
+	maxDialTimeout = 2 * time.Second
+	// stderrTailSize is the number of bytes of the server stderr kept to report why it exited
+	stderrTailSize = 4096
+)
+
+// connectToServer waits till the gRPC server at serverUri is ready and returns a connection to it.
+// for a unix socket it first waits for the socket file. the server is ready once a dial succeeds
+// and its health check, if the server implements the gRPC health service, reports serving.
+// probes are retried with exponential backoff till the timeout.
+// creds are the transport credentials of the connection.
+// exited, if not nil, receives the error of the server process if it exits, so waiting stops immediately.
+// waiting stops with errInterrupted when parent is cancelled.
+func connectToServer(parent context.Context, serverUri string, creds credentials.TransportCredentials, timeout time.Duration, exited <-chan error) (conn *grpc.ClientConn, err error) {
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+	socket := unixSocketPath(serverUri)
+	delay := firstProbeDelay
+	var probeErr error
+	for {
+		if socket == "" || fileExists(socket) {
+			conn, probeErr = probeServer(ctx, serverUri, creds)
+			if probeErr == nil {
+				return
+			}
+		} else {
+			probeErr = errors.New("socket " + socket + " not created")
+		}
+		select {
+		case err = <-exited:
+			return
+		case <-ctx.Done():
+			err = errors.Wrapf(probeErr, "server not ready after %v", timeout)
+			if parent.Err() != nil {
+				err = errInterrupted
+			}
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > maxProbeDelay {
+			delay = maxProbeDelay
+		}
+	}
+}
+
+// probeServer dials the server and checks its health. the connection is closed if the server is not ready.
+func probeServer(ctx context.Context, serverUri string, creds credentials.TransportCredentials) (conn *grpc.ClientConn, err error) {
+	dialCtx, cancel := context.WithTimeout(ctx, maxDialTimeout)
+	defer cancel()
+	conn, err = grpc.DialContext(dialCtx, serverUri, grpc.WithTransportCredentials(creds), grpc.WithBlock(), grpc.WithReturnConnectionError())
+	if err != nil {
+		err = errors.Wrap(err, "failed to connect to server")
+		return
+	}
+	resp, err := healthpb.NewHealthClient(conn).Check(dialCtx, &healthpb.HealthCheckRequest{})
+	switch {
+	case status.Code(err) == codes.Unimplemented:
+		// no health service. the server accepts connections, so it is ready.
+		err = nil
+	case err != nil:
+		err = errors.Wrap(err, "health check failed")
+	case resp.Status != healthpb.HealthCheckResponse_SERVING:
+		err = errors.New("server is " + resp.Status.String())
+	}
+	if err != nil {
+		conn.Close()
+		conn = nil
+	}
+	return
+}
+
+// verifyBluBracket checks that the server at the other end of the connection serves api.BluBracket
+// by opening an empty AnalyzeStream.
+func verifyBluBracket(conn *grpc.ClientConn, timeout time.Duration) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	stream, err := pb.NewBluBracketClient(conn).AnalyzeStream(ctx)
+	if err == nil {
+		err = stream.CloseSend()
+	}
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	switch {
+	case err == io.EOF:
+		err = nil
+	case status.Code(err) == codes.Unimplemented:
+		err = errors.New("server does not serve " + pb.BluBracket_ServiceDesc.ServiceName)
+	case err != nil:
+		err = errors.Wrap(err, "failed to verify "+pb.BluBracket_ServiceDesc.ServiceName+" server")
+	}
+	return
+}
+
+// unixSocketPath returns the socket file of a unix socket uri, or an empty string for other uris.
+func unixSocketPath(serverUri string) string {
+	switch {
+	case strings.HasPrefix(serverUri, "unix://"):
+		return strings.TrimPrefix(serverUri, "unix://")
+	case strings.HasPrefix(serverUri, "unix:"):
+		return strings.TrimPrefix(serverUri, "unix:")
+	}
+	return ""
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// tailWriter keeps the last bytes written to it, e.g. the stderr tail of a process
+type tailWriter struct {
+	mu   sync.Mutex
+	size int
+	buf  []byte
+}
+
+func newTailWriter(size int) *tailWriter {
+	return &tailWriter{size: size}
+}
+
+func (w *tailWriter) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	if len(w.buf) > w.size {
+		w.buf = w.buf[len(w.buf)-w.size:]
+	}
+	return len(p), nil
+}
+
+// String returns the bytes kept, trimmed
+func (w *tailWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return strings.TrimSpace(string(w.buf))
+}
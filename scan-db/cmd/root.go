@@ -4,24 +4,25 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"io"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	pb "github.com/BluBracket/database-risk-scanner/grpc/api"
+	"github.com/BluBracket/database-risk-scanner/scan-db/detect"
+	"github.com/BluBracket/database-risk-scanner/scan-db/engine"
 	"github.com/bserdar/jsonstream"
 	"github.com/glebarez/sqlite"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlserver"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var (
@@ -38,13 +39,103 @@ var (
 	idColumn string
 	// output contains parsed value for '--output' flag
 	output string
+	// keyColumn contains parsed value for '--key-column' flag
+	keyColumn string
+	// rowColumns contains parsed value for '--row-document' flag
+	rowColumns []string
+	// scanDefinitions contains parsed value for '--scan-definitions' flag
+	scanDefinitions bool
+	// rulesPath contains parsed value for '--rules' flag
+	rulesPath string
+	// detectPII contains parsed value for '--pii' flag
+	detectPII bool
+	// detectEntropy contains parsed value for '--entropy' flag
+	detectEntropy bool
+	// entropyThresholds contains parsed value for '--entropy-threshold' flag
+	entropyThresholds map[string]string
+	// entropyMinLengths contains parsed value for '--entropy-min-length' flag
+	entropyMinLengths map[string]int
+	// columnSemantics contains parsed value for '--column-semantics' flag
+	columnSemantics bool
+	// hashAudit contains parsed value for '--hash-audit' flag
+	hashAudit bool
+	// minBcryptCost contains parsed value for '--min-bcrypt-cost' flag
+	minBcryptCost int
+	// suppressionsPath contains parsed value for '--suppressions' flag
+	suppressionsPath string
+	// showSuppressed contains parsed value for '--show-suppressed' flag
+	showSuppressed bool
+	// baselinePath contains parsed value for '--baseline' flag
+	baselinePath string
+	// failOn contains parsed value for '--fail-on' flag
+	failOn string
+	// minSeverity contains parsed value for '--min-severity' flag
+	minSeverity string
+	// categories contains parsed value for '--category' flag
+	categories []string
+	// serverAddress contains parsed value for '--server' flag
+	serverAddress string
+	// tlsCAPath contains parsed value for '--tls-ca' flag
+	tlsCAPath string
+	// tlsCertPath contains parsed value for '--tls-cert' flag
+	tlsCertPath string
+	// tlsKeyPath contains parsed value for '--tls-key' flag
+	tlsKeyPath string
+	// tlsServerName contains parsed value for '--tls-server-name' flag
+	tlsServerName string
+	// tlsPins contains parsed value for '--tls-pin' flag
+	tlsPins []string
+	// insecureTransport contains parsed value for '--insecure' flag
+	insecureTransport bool
+	// checkpointFile contains parsed value for '--checkpoint' flag
+	checkpointFile string
+	// enginePath contains parsed value for '--engine-path' flag
+	enginePath string
+	// engineArgs contains parsed value for '--engine-arg' flag
+	engineArgs []string
+	// engineEnvVars contains parsed value for '--engine-env' flag
+	engineEnvVars map[string]string
+	// engineMinVersion contains parsed value for '--engine-min-version' flag
+	engineMinVersion string
+	// engineSha256 contains parsed value for '--engine-sha256' flag
+	engineSha256 string
+	// maxEngineRestarts contains parsed value for '--max-engine-restarts' flag
+	maxEngineRestarts int
+	// workers contains parsed value for '--workers' flag
+	workers int
+	// serverStartTimeout contains parsed value for '--server-start-timeout' flag
+	serverStartTimeout time.Duration
+	// engineType can be auto, blubracket or native
+	// it contains parsed value for the '--engine' flag. defaults to auto.
+	engineType engineEnum = engineEnum(engineAuto)
 )
 
 var (
 	// count of risks found
-	riskCount = 0
+	riskCount counter
+	// count of risks suppressed
+	suppressedCount counter
+	// count of risks found in the baseline
+	baselineCount counter
+	// count of records read for scanning
+	scannedCount counter
+	// accounting of the records sent to the detection engine
+	recordAccounting = detect.NewAccounting()
 )
 
+// counter is a count safe for concurrent use, e.g. by the handlers of parallel detectors
+type counter struct {
+	n int64
+}
+
+func (c *counter) inc() {
+	atomic.AddInt64(&c.n, 1)
+}
+
+func (c *counter) get() int {
+	return int(atomic.LoadInt64(&c.n))
+}
+
 var rootCmd = &cobra.Command{
 	Use:   "scan-db",
 	Short: "scan-db scans database for risks",
@@ -67,12 +158,28 @@ refer https://github.com/go-sql-driver/mysql#dsn-data-source-name for mysql uri
 it scans mssql DB 'sqldb' at localhost using windows authentication for given table and column. 
 refer https://github.com/microsoft/go-mssqldb and sqlserver documentation for uri (connection string) format.
 
-`,
+./scan-db --dbtype sqlite --uri _testdata/sqlite/accounts.db --scan-definitions --output out.json
+it scans definitions of procedures, functions, triggers, views, column defaults and comments
+instead of table data. record id of a risk is '<object type>:<schema>.<name>'.
+
+./scan-db --dbtype sqlite --uri _testdata/sqlite/accounts.db --table accounts --id-column id --column notes --fail-on high --category SECRET,PII
+it reports only SECRET and PII risks and exits with 1 if any of them is of high or critical severity.
+
+./scan-db --dbtype sqlite --uri _testdata/sqlite/accounts.db --table accounts --id-column id --row-document username,password,notes --output out.json
+it scans the given columns of each row together as a document labelled with the column names,
+and reports risks made of several columns, like a username and a password in the same row.
+
+./scan-db --dbtype sqlite --uri _testdata/sqlite/accounts.db --table settings --id-column owner_id --key-column key --column value --output out.json
+it scans a key/value table. the key of a row tells what its value is, so plaintext values under keys
+like smtp_password are reported whatever their format. the key is reported with the risk.
+
+` + exitCodesText,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return validateFlags()
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		err := scanDb()
-		if err != nil {
-			fmt.Println(err)
-		}
+		exitCode = resultExitCode(err)
 	},
 }
 
@@ -81,217 +188,405 @@ refer https://github.com/microsoft/go-mssqldb and sqlserver documentation for ur
 // to scan the data for risks.
 // on completion, it stops the blubracket cli process.
 func scanDb() (err error) {
+	detectorOpts, err := loadDetectorOptions()
+	if err != nil {
+		return
+	}
+	var suppressed suppressions
+	if suppressionsPath != "" {
+		suppressed, err = loadSuppressions(suppressionsPath)
+		if err != nil {
+			return
+		}
+	}
+	var base *baseline
+	if baselinePath != "" {
+		base, err = loadBaseline(baselinePath)
+		if err != nil {
+			return
+		}
+	}
+
+	// stop gracefully on SIGINT or SIGTERM
+	scanCtx, streamCtx, release := handleSignals()
+	defer release()
+
 	// connect to db
 	db, err := connectToDb()
 	if err != nil {
 		return err
 	}
-	fmt.Println("connected to db.")
+	logger.info("connected to db")
+	detectorOpts.loadColumnComments(db)
 
 	// open output file
-	out := os.Stdout
-	if output != "" {
-		out, err = os.Create(output)
-		if err != nil {
-			err = errors.Wrap(err, "failed to open output file for write")
-			return
-		}
+	out, err := openOutput()
+	if err != nil {
+		return
+	}
+	if out != os.Stdout {
 		defer out.Close()
 	}
 	outputStream := jsonstream.NewLineWriter(out)
 
 	// query and send data for scanning.
-	rows, err := db.Table(table).Select(idColumn, column).Rows()
+	var rows *sql.Rows
+	// the query is cancelled on interruption, so no more rows are read
+	db = db.WithContext(scanCtx)
+	switch {
+	case scanDefinitions:
+		rows, err = db.Raw(definitionsQuery()).Rows()
+	case len(rowColumns) > 0:
+		rows, err = db.Table(table).Select(append([]string{idColumn}, rowColumns...)).Clauses(scanOrder()).Rows()
+	case keyColumn != "":
+		rows, err = db.Table(table).Select(idColumn, keyColumn, column).Clauses(scanOrder()).Rows()
+	default:
+		rows, err = db.Table(table).Select(idColumn, column).Clauses(scanOrder()).Rows()
+	}
 	if err != nil {
 		err = errors.Wrap(err, "failed to query")
 		return
 	}
 	defer rows.Close()
 
-	// start CLI as server. open a connection to server.
-	cmd, conn, err := startCLIServer()
+	// start detection engine as server. open a connection to server.
+	handler := riskWriter(outputStream, suppressed, base)
+	d, stop, err := startEngine(scanCtx, streamCtx, handler)
 	if err != nil {
 		return
 	}
-	defer cmd.Process.Kill()
-	defer conn.Close()
-	c := pb.NewBluBracketClient(conn)
+	defer stop()
+	d = withDetectors(d, detectorOpts, handler)
 
 	// scan rows
-	err = scanRows(rows, c, outputStream)
+	lastRecordId, err := scanRows(scanCtx, rows, d)
+	logAccounting()
+	interrupted := scanCtx.Err() != nil
+	if interrupted {
+		// the records in flight may have been aborted, so the checkpoint is written whatever the error
+		partialScan = true
+		checkpointErr := writeCheckpoint(lastRecordId)
+		if err == errInterrupted {
+			err = checkpointErr
+		}
+	}
 	if err != nil {
+		partialScan = partialScan || scannedCount.get() > 0
 		return
 	}
+	if detectorOpts.hashAudit != nil {
+		err = writeHashSummary(detectorOpts.hashAudit, outputStream)
+		if err != nil {
+			return
+		}
+	}
 
-	if riskCount == 0 {
-		fmt.Println("no risks found")
-	} else {
-		fmt.Printf("found %d risk(s)\n", riskCount)
+	logger.info("risks found", "count", riskCount.get())
+	if filteredCount.get() > 0 {
+		logger.info("risks filtered below --min-severity or outside --category", "count", filteredCount.get())
+	}
+	if suppressedCount.get() > 0 {
+		logger.info("risks suppressed", "count", suppressedCount.get())
 	}
-	fmt.Println("scan completed")
+	if base != nil && interrupted {
+		logger.info("risks in baseline. disappeared risks are not reported for an interrupted scan", "count", baselineCount.get())
+	} else if base != nil {
+		var disappeared int
+		disappeared, err = base.writeDisappeared(outputStream)
+		if err != nil {
+			return
+		}
+		logger.info("risks in baseline", "count", baselineCount.get(), "disappeared", disappeared)
+	}
+	if interrupted {
+		logger.warn("scan interrupted. the output holds partial results")
+		return
+	}
+	logger.info("scan completed")
 	return
 }
 
-// scanRows queries the textual data selected per row and send to server to scan for risks.
-// it streams each record data to server for scanning and saves the risks found in the output file in json format.
-// it tags each risk with the recordId for correlation.
-func scanRows(rows *sql.Rows, client pb.BluBracketClient, out jsonstream.LineWriter) (err error) {
-	c, err := client.AnalyzeStream(context.Background())
-	if err != nil {
-		err = errors.Wrap(err, "AnalyzeStream call failed")
+// openOutput opens the output file given by '--output' flag for write. if the flag is not given, it returns stdout.
+func openOutput() (out *os.File, err error) {
+	if output == "" {
+		out = os.Stdout
 		return
 	}
+	out, err = os.Create(output)
+	if err != nil {
+		err = errors.Wrap(err, "failed to open output file for write")
+	}
+	return
+}
 
-	// read response(s) on stream while sending data
-	errCh := make(chan error, 1)
-	go readRisks(c, out, errCh)
-
-	// read result set. send data to server for scanning.
-	fmt.Println("sending records for scanning")
+// progressInterval is the interval of the progress log entries while reading the records
+const progressInterval = 5 * time.Second
+
+// scanRows queries the textual data selected per row and submits it to the detector to scan for risks.
+// the detector reports the risks found tagged with the recordId for correlation.
+// with '--row-document' flag, the columns of a row are submitted together as a row document.
+// with '--key-column' flag, the value is submitted with its key.
+// once ctx is cancelled no more rows are read, the detector is flushed and errInterrupted is returned
+// with the id of the last record read.
+func scanRows(ctx context.Context, rows *sql.Rows, d detect.Detector) (lastRecordId string, err error) {
+	// read result set. send data to detector for scanning.
+	logger.info("sending records for scanning")
 	start := time.Now()
-	count := 1
-	for rows.Next() {
-		var r record
-		err = rows.Scan(&r.id, &r.text)
-		// fmt.Printf(" data - %v, %v\n", r.id, string(r.text.b))
+	lastProgress := start
+	// the values of 'column' or of the '--row-document' columns are scanned
+	values := 1
+	if len(rowColumns) > 0 {
+		values = len(rowColumns)
+	}
+	for ctx.Err() == nil && rows.Next() {
+		r := record{texts: make([]textType, values)}
+		dest := []interface{}{&r.id}
+		if keyColumn != "" {
+			dest = append(dest, &r.key)
+		}
+		for i := range r.texts {
+			dest = append(dest, &r.texts[i])
+		}
+		err = rows.Scan(dest...)
 		if err != nil {
 			err = errors.Wrap(err, "failed to read query result")
 			return
 		}
-		fmt.Printf("\rprocessing record : %d", count)
-		count++
-		if r.text.b == nil {
+		scannedCount.inc()
+		if time.Since(lastProgress) >= progressInterval {
+			lastProgress = time.Now()
+			logger.info("processing records", "records", scannedCount.get())
+		}
+		lastRecordId = fmt.Sprintf("%v", r.id)
+		logger.debug("record read", "record_id", lastRecordId)
+		if r.empty() {
 			// ignore
 			continue
 		}
-		err = sendData(c, r.id, r.text.b)
+		rec := detect.Record{Id: lastRecordId, Column: column, Key: string(r.key.b), Data: r.texts[0].b}
+		if len(rowColumns) > 0 {
+			rec.Column = ""
+			rec.Data, rec.Fields = rowDocument(rowColumns, r.texts)
+		}
+		err = d.Submit(rec)
 		if err != nil {
 			err = errors.Wrap(err, "failed to send record")
 			return
 		}
 	}
-	fmt.Println()
-	// close send stream
-	err = c.CloseSend()
-	if err != nil {
-		err = errors.Wrap(err, "failed to close send stream")
-		return
-	}
+	interrupted := ctx.Err() != nil
 	err = rows.Err()
-	if err != nil {
+	if err != nil && !interrupted {
 		err = errors.Wrap(err, "failed to retrieve query result")
 		return
 	}
-	err = <-errCh
+	// flush detector and wait for the remaining risks
+	err = d.Close()
 	duration := time.Since(start)
-	fmt.Printf("time taken: %v\n", duration)
+	logger.info("records scanned", "records", scannedCount.get(), "duration", duration)
+	if err == nil && interrupted {
+		err = errInterrupted
+	}
 	return
 }
 
-// startCLIServer launches the BluBracket CLI as a local gRPC server process.
-// it also establishes a connection to the server.
-// it assumes that blubracket binary to be in PATH
-func startCLIServer() (cmd *exec.Cmd, conn *grpc.ClientConn, err error) {
+// scanOrder orders the records of the table by id column, and key column in key/value mode,
+// so the last record id of an interrupted scan tells which records were read.
+func scanOrder() clause.OrderBy {
+	order := clause.OrderBy{Columns: []clause.OrderByColumn{{Column: clause.Column{Name: idColumn}}}}
+	if keyColumn != "" {
+		order.Columns = append(order.Columns, clause.OrderByColumn{Column: clause.Column{Name: keyColumn}})
+	}
+	return order
+}
+
+// startEngine starts the detection engine selected by '--engine' flag and returns a detector
+// spreading the records across '--workers' streams.
+// a BluBracket CLI process is started per worker and supervised, see supervisedEngine.
+// the native engine and a '--server' serve the streams of all the workers on a single connection.
+// with '--server' flag, it connects to the existing server instead, which is not stopped.
+// stop closes the connections and stops the engines.
+// starting is abandoned when startCtx is cancelled, cancelling streamCtx aborts the streams.
+func startEngine(startCtx, streamCtx context.Context, h detect.Handler) (d detect.Detector, stop func(), err error) {
+	var stops []func()
+	stop = func() {
+		for _, s := range stops {
+			s()
+		}
+	}
 	defer func() {
-		if err != nil && cmd != nil && cmd.Process != nil {
-			cmd.Process.Kill()
+		if err != nil {
+			stop()
 		}
 	}()
-	fmt.Println("Starting BluBracket local gRPC server...")
-	const processName = "blubracket"
-	serverUri := "unix:" + filepath.Join(os.TempDir(), fmt.Sprintf("blubracket.grpcserver.dbscan-%d", os.Getpid()))
-	cmd = exec.Command(processName, "serve", serverUri)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err = cmd.Start()
-	if err != nil {
-		err = errors.Wrap(err, "failed to start BluBracket CLI process")
+	var conn *grpc.ClientConn
+	switch selectedEngine() {
+	case engineEnum(engineBluBracket):
+		var bin string
+		bin, err = resolveEngineBinary()
+		if err != nil {
+			return
+		}
+		var engines []detect.Detector
+		for i := 0; i < workers; i++ {
+			var s *supervisedEngine
+			s, err = startSupervisedEngine(startCtx, streamCtx, cliLauncher(bin), i, h)
+			if err != nil {
+				return
+			}
+			engines = append(engines, s)
+			stops = append(stops, s.stop)
+		}
+		d = detect.Parallel(engines...)
 		return
+	case engineEnum(engineNative):
+		var stopServer func()
+		conn, stopServer, err = startNativeServer()
+		if err != nil {
+			return
+		}
+		stops = append(stops, stopServer)
+	default:
+		conn, err = connectToExistingServer(startCtx, serverAddress)
+		if err != nil {
+			return
+		}
 	}
-	// establish a connection
-	conn, err = connectToServer(serverUri)
+	stops = append([]func(){func() { conn.Close() }}, stops...)
+	d, err = openStreams(streamCtx, conn, h)
 	return
 }
 
-// connectToServer establish a connection to the local gRPC server listening at serverUri.
-// it retries a couple of times before failing.
-func connectToServer(serverUri string) (conn *grpc.ClientConn, err error) {
-	// initial wait
-	time.Sleep(4 * time.Second)
-
-	s := 1
-	retries := 3
-	for {
-		// wait for few seconds before dialing
-		time.Sleep(time.Duration(s) * time.Second)
-		ctx, _ := context.WithTimeout(context.Background(), time.Second)
-		conn, err = grpc.DialContext(ctx, serverUri, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock())
-		if err == nil {
-			return
-		}
+// selectedEngine returns the engine selected by '--engine' flag. auto selects the BluBracket CLI
+// if '--engine-path' is given or it is in PATH, else the native engine. it returns an empty engine for '--server'.
+func selectedEngine() engineEnum {
+	if serverAddress != "" {
+		return ""
+	}
+	if engineType != engineEnum(engineAuto) {
+		return engineType
+	}
+	if enginePath != "" {
+		return engineEnum(engineBluBracket)
+	}
+	if _, err := exec.LookPath(blubracketProcessName); err == nil {
+		return engineEnum(engineBluBracket)
+	}
+	return engineEnum(engineNative)
+}
 
-		retries--
-		s *= 2
-		if err != nil && retries <= 0 {
-			err = errors.Wrap(err, "failed to connect to server")
+// openStreams opens a stream per worker on the connection and spreads the records across them.
+// the record id is sent as stream context and reported back with its risks, so risks are correlated
+// whatever the stream. cancelling ctx aborts the streams.
+func openStreams(ctx context.Context, conn *grpc.ClientConn, h detect.Handler) (d detect.Detector, err error) {
+	var streams []detect.Detector
+	for i := 0; i < workers; i++ {
+		var s detect.Detector
+		s, err = detect.NewAccountedStream(ctx, pb.NewBluBracketClient(conn), h, recordAccounting)
+		if err != nil {
 			return
-		} else {
-			fmt.Printf("\rretry connect to server after %d seconds. ", s)
 		}
+		streams = append(streams, s)
 	}
+	d = detect.Parallel(streams...)
+	return
 }
 
-// sendData sends metadata and data msg on the stream
-func sendData(c pb.BluBracket_AnalyzeStreamClient, id interface{}, data []byte) (err error) {
-	// send metadata msg
-	recordId := fmt.Sprintf("%v", id)
-	// fmt.Printf("sending record id - %v", recordId)
-	err = c.Send(&pb.AnalyzeStreamRequest{Metadata: &pb.AnalyzeStreamMetadata{Context: recordId}})
+// connectToExistingServer connects to the BluBracket gRPC server listening at serverUri,
+// e.g. a long-lived sidecar shared by scans, and checks that it serves api.BluBracket.
+// a unix socket is given as unix:///path, a tcp address as host:port.
+// TLS is used over the network, see serverCredentials.
+func connectToExistingServer(ctx context.Context, serverUri string) (conn *grpc.ClientConn, err error) {
+	creds, err := serverCredentials(serverUri)
 	if err != nil {
-		err = errors.Wrap(err, "failed to send metadata msg")
 		return
 	}
-	// send data msg
-	err = c.Send(&pb.AnalyzeStreamRequest{Data: data})
+	logger.info("connecting to BluBracket gRPC server", "server", serverUri)
+	conn, err = connectToServer(ctx, serverUri, creds, serverStartTimeout, nil)
 	if err != nil {
-		err = errors.Wrap(err, "failed to send data msg")
 		return
 	}
+	err = verifyBluBracket(conn, serverStartTimeout)
+	if err != nil {
+		conn.Close()
+		conn = nil
+	}
 	return
 }
 
-// readRisks receive response(s) containing risk found. it adds recordId to the risk for correlation and
-// writes it to the output file in json.
-func readRisks(c pb.BluBracket_AnalyzeStreamClient, out jsonstream.LineWriter, errCh chan error) {
-	var err error
-	defer func() {
-		errCh <- err
-		close(errCh)
-	}()
-
-	for {
-		var asResponse *pb.AnalyzeStreamResponse
-		asResponse, err = c.Recv()
-		if err == io.EOF {
-			err = nil
-			break
+// riskWriter returns a detect.Handler which writes each risk found to the output and counts it.
+// in key/value mode the key of the record is written with the risk.
+// attributes of cryptographic material (keys, certificates, JWTs) in the risk value are added to the tags.
+// risks matching a suppression are counted and dropped, or written with 'Suppressed' if '--show-suppressed' flag is given.
+// risks in the baseline, if any, are counted and dropped.
+func riskWriter(out jsonstream.LineWriter, suppressed suppressions, base *baseline) detect.Handler {
+	return detect.Synchronized(func(f detect.Finding) (err error) {
+		engine.EnrichCrypto(f.Risk)
+		col := column
+		if len(rowColumns) > 0 {
+			var labelMade bool
+			col, labelMade = rowDocumentColumn(f.Risk)
+			if labelMade {
+				return
+			}
 		}
-		if err != nil {
-			err = errors.Wrap(err, "failed receiving data from server")
+		// the records with risks of any detector are accounted, including filtered risks
+		streamName := f.Key
+		if streamName == "" {
+			streamName = column
+		}
+		recordAccounting.Found(f.RecordId, streamName)
+		var key string
+		if keyColumn != "" {
+			key = f.Key
+		}
+		// a baseline risk found again did not disappear, even if it is dropped by a filter or suppressed
+		inBaseline := base != nil && base.contains(table, col, f.RecordId, key, f.Risk)
+		if filtered(f.Risk) {
+			filteredCount.inc()
 			return
 		}
-		// fmt.Printf("response context: %v\n", asResponse.Context)
-		err = writeRisk(asResponse.Metadata.Context, asResponse.Risk, out)
-		if err != nil {
+		r := riskFields(table, col, f.RecordId, f.Risk)
+		if keyColumn != "" {
+			r["Key"] = key
+		}
+		if s := suppressed.match(table, col, f.RecordId, f.Risk); s != nil {
+			suppressedCount.inc()
+			if !showSuppressed {
+				return
+			}
+			r["Suppressed"] = true
+			r["SuppressionReason"] = s.Reason
+		} else if inBaseline {
+			baselineCount.inc()
 			return
+		} else {
+			riskCount.inc()
+			if failing(f.Risk) {
+				failingCount.inc()
+			}
+		}
+		err = out.Marshal(r)
+		if err != nil {
+			err = errors.Wrap(err, "failed writing risk to output")
 		}
-		riskCount++
+		return
+	})
+}
+
+// writeRisk writes risk in json format to the output including table, column and recordId
+func writeRisk(table, column, recordId string, risk *pb.Risk, out jsonstream.LineWriter) (err error) {
+	err = out.Marshal(riskFields(table, column, recordId, risk))
+	if err != nil {
+		err = errors.Wrap(err, "failed writing risk to output")
+		return
 	}
+	return
 }
 
-// writeRisk writes risk in json format to the output including recordId
-func writeRisk(recordId string, risk *pb.Risk, out jsonstream.LineWriter) (err error) {
-	r := map[string]interface{}{
+// riskFields returns the fields of a risk written to the output
+func riskFields(table, column, recordId string, risk *pb.Risk) map[string]interface{} {
+	return map[string]interface{}{
 		"Table":          table,
 		"Column":         column,
 		"RecordId":       recordId,
@@ -306,18 +601,12 @@ func writeRisk(recordId string, risk *pb.Risk, out jsonstream.LineWriter) (err e
 		"Col2":           risk.Col2,
 		"Tags":           risk.Tags,
 	}
-	err = out.Marshal(r)
-	if err != nil {
-		err = errors.Wrap(err, "failed writing risk to output")
-		return
-	}
-	return
 }
 
 // connectToDb connects to postgres database.
 // for connecting to other gorm supported databases, refer https://gorm.io/docs/connecting_to_the_database.html
 func connectToDb() (db *gorm.DB, err error) {
-	db, err = gorm.Open(getDialector(), &gorm.Config{})
+	db, err = gorm.Open(getDialector(), &gorm.Config{Logger: gormLogger{}})
 	if err != nil {
 		err = errors.Wrap(err, "failed to connect to database")
 		return
@@ -326,6 +615,70 @@ func connectToDb() (db *gorm.DB, err error) {
 	return
 }
 
+// validateFlags checks that the flags required for the selected scan mode are given.
+func validateFlags() (err error) {
+	err = validateFilterFlags()
+	if err != nil {
+		return
+	}
+	if serverAddress != "" && engineType == engineEnum(engineNative) {
+		err = errors.New("--server can not be used with --engine native")
+		return
+	}
+	err = validateTLSFlags()
+	if err != nil {
+		return
+	}
+	if workers < 1 {
+		err = errors.New("--workers must be at least 1")
+		return
+	}
+	err = validateEngineFlags()
+	if err != nil {
+		return
+	}
+	if scanDefinitions {
+		if hashAudit {
+			err = errors.New("--hash-audit can not be used with --scan-definitions")
+		}
+		if len(rowColumns) > 0 {
+			err = errors.New("--row-document can not be used with --scan-definitions")
+		}
+		if keyColumn != "" {
+			err = errors.New("--key-column can not be used with --scan-definitions")
+		}
+		return
+	}
+	required := []struct{ name, value string }{{"table", table}, {"id-column", idColumn}}
+	if len(rowColumns) > 0 {
+		switch {
+		case column != "":
+			err = errors.New("--column can not be used with --row-document")
+		case keyColumn != "":
+			err = errors.New("--key-column can not be used with --row-document")
+		case hashAudit:
+			err = errors.New("--hash-audit can not be used with --row-document")
+		case columnSemantics:
+			err = errors.New("--column-semantics can not be used with --row-document")
+		}
+		if err != nil {
+			return
+		}
+	} else {
+		required = append(required, struct{ name, value string }{"column", column})
+	}
+	var missing []string
+	for _, f := range required {
+		if f.value == "" {
+			missing = append(missing, f.name)
+		}
+	}
+	if len(missing) > 0 {
+		err = errors.New(fmt.Sprintf("required flag(s) \"%s\" not set", strings.Join(missing, `", "`)))
+	}
+	return
+}
+
 func getDialector() (d gorm.Dialector) {
 	switch dbType {
 	case dbTypeEnum(dbTypePostgres):
@@ -343,13 +696,25 @@ func getDialector() (d gorm.Dialector) {
 	return
 }
 
-// record stores values for 'idColumn' and 'column' to be scanned for a row
+// record stores values for 'idColumn' and 'column' (or the '--row-document' columns) to be scanned for a row,
+// and the value of 'keyColumn' in key/value mode
 type record struct {
-	id   interface{}
-	text textType
+	id    interface{}
+	key   textType
+	texts []textType
 }
 
-// textType implements the Scanner interface required for custom type
+// empty tells if all the values to be scanned are null
+func (r record) empty() bool {
+	for _, t := range r.texts {
+		if t.b != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// textType implements the Scanner interface required for custom type. it owns a copy of the data.
 // refer https://pkg.go.dev/database/sql#Scanner
 type textType struct {
 	b []byte
@@ -367,7 +732,9 @@ func (t *textType) Scan(rawData interface{}) (err error) {
 	}
 	if b, ok := rawData.([]byte); ok {
 		//fmt.Printf("data : %s\n", string(b))
-		t.b = b
+		// the driver memory is valid till the next Scan only, and the record may still be
+		// submitted by another goroutine, e.g. with '--workers'
+		t.b = append([]byte(nil), b...)
 		return
 	}
 	err = errors.New(fmt.Sprintf("unexpected data type: %T", rawData))
@@ -379,8 +746,9 @@ func (t *textType) Scan(rawData interface{}) (err error) {
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
-		os.Exit(1)
+		os.Exit(exitError)
 	}
+	os.Exit(exitCode)
 }
 
 // dbTypeEnum is custom value type and implements pFlag.Value interface
@@ -415,15 +783,117 @@ func (t *dbTypeEnum) Set(v string) error {
 	}
 }
 
+// engineEnum is custom value type and implements pFlag.Value interface
+type engineEnum string
+
+const (
+	// engineAuto uses the BluBracket CLI if it is in PATH, else the native engine
+	engineAuto       string = "auto"
+	engineBluBracket string = "blubracket"
+	engineNative     string = "native"
+)
+
+var supportedAlphabetsText = strings.Join(engine.Alphabets, ", ")
+
+var supportedEngines = []string{engineAuto, engineBluBracket, engineNative}
+var supportedEnginesText = strings.Join(supportedEngines, ", ")
+
+func (t *engineEnum) String() string {
+	return string(*t)
+}
+
+func (t *engineEnum) Type() string {
+	return "engineEnum"
+}
+
+func (t *engineEnum) Set(v string) error {
+	switch v {
+	case engineAuto, engineBluBracket, engineNative:
+		*t = engineEnum(v)
+		return nil
+	default:
+		return errors.New(fmt.Sprintf("Unsupported engine : %s. Supported engines are (%s)",
+			v, supportedEnginesText))
+	}
+}
+
 func init() {
-	rootCmd.Flags().VarP(&dbType, "dbtype", "d", fmt.Sprintf("Specify database (%s).", supportedDatabasesText))
-	rootCmd.Flags().StringVarP(&uri, "uri", "u", "", "Specify database uri")
+	rootCmd.PersistentFlags().VarP(&dbType, "dbtype", "d", fmt.Sprintf("Specify database (%s).", supportedDatabasesText))
+	rootCmd.PersistentFlags().StringVarP(&uri, "uri", "u", "", "Specify database uri")
 	rootCmd.Flags().StringVarP(&table, "table", "t", "", "Specify table name")
 	rootCmd.Flags().StringVarP(&column, "column", "c", "", "Specify column name to scan")
 	rootCmd.Flags().StringVarP(&idColumn, "id-column", "i", "", "Specify record-id column name for reference in result")
-	rootCmd.Flags().StringVarP(&output, "output", "o", "", "Specify output file to store results. Else stdout.")
-	rootCmd.MarkFlagRequired("uri")
-	rootCmd.MarkFlagRequired("table")
-	rootCmd.MarkFlagRequired("column")
-	rootCmd.MarkFlagRequired("id-column")
+	rootCmd.PersistentFlags().StringVarP(&output, "output", "o", "", "Specify output file to store results. Else stdout.")
+	rootCmd.PersistentFlags().Var(&logger.level, "log-level", fmt.Sprintf("Specify level of the diagnostics logged to stderr (%s)", supportedLogLevelsText))
+	rootCmd.PersistentFlags().Var(&logger.format, "log-format", fmt.Sprintf("Specify format of the diagnostics logged to stderr (%s)", supportedLogFormatsText))
+	rootCmd.Flags().StringSliceVar(&rowColumns, "row-document", nil, "Specify columns to scan together per row, e.g. username,password,notes. "+
+		"Each row is scanned as a document with a line per column labelled with the column name, and risks made of several columns "+
+		"are reported: credential_pair (username and plaintext password) and pii_bundle (name with date of birth, national id, "+
+		"address, email or phone), listing the participating columns. Replaces --column.")
+	rootCmd.Flags().StringVar(&keyColumn, "key-column", "", "Specify key column of a key/value table, e.g. settings(owner_id, key, value). "+
+		"--column is the value column. The key is used as context for detection: plaintext values under keys holding credentials "+
+		"(e.g. smtp_password, stripe_secret) are reported whatever their format, and the column condition of custom rules matches the key. "+
+		"The key is written with each risk.")
+	rootCmd.Flags().BoolVar(&scanDefinitions, "scan-definitions", false,
+		"Scan definitions of procedures, functions, triggers, views, column defaults and comments instead of table data. "+
+			"--table, --column and --id-column are not required in this mode.")
+	rootCmd.Flags().Var(&engineType, "engine", fmt.Sprintf("Specify detection engine (%s). "+
+		"auto uses BluBracket CLI if it is in PATH, else the built-in native engine.", supportedEnginesText))
+	rootCmd.Flags().StringVar(&checkpointFile, "checkpoint", "", "Specify file to write the checkpoint (records scanned, last record id) "+
+		"to when the scan is interrupted by SIGINT or SIGTERM. Defaults to the --output file with .checkpoint extension.")
+	rootCmd.Flags().IntVar(&workers, "workers", 1, "Specify number of parallel detection streams. "+
+		"A BluBracket CLI process is started per worker, a --server or the native engine serves all the streams. "+
+		"Risks are written as found, not in record order.")
+	rootCmd.Flags().StringVar(&enginePath, "engine-path", "", "Specify path of the BluBracket CLI binary. Else blubracket is looked up in PATH.")
+	rootCmd.Flags().StringArrayVar(&engineArgs, "engine-arg", nil, "Specify extra argument of 'blubracket serve', before the server uri. "+
+		"Repeat the flag for several arguments.")
+	rootCmd.Flags().StringToStringVar(&engineEnvVars, "engine-env", nil, "Specify environment variables of the BluBracket CLI, e.g. HOME=/tmp. "+
+		fmt.Sprintf("The CLI gets the environment of scan-db without proxy variables (%s), so the data can not leave the machine through a proxy.",
+			strings.Join(proxyVariables, ", ")))
+	rootCmd.Flags().StringVar(&engineMinVersion, "engine-min-version", defaultMinEngineVersion, "Specify minimum BluBracket CLI version "+
+		"(major.minor.patch), checked at startup against 'blubracket --version'. Empty to skip the version check.")
+	rootCmd.Flags().StringVar(&engineSha256, "engine-sha256", "", "Specify sha256 (hex) of the BluBracket CLI binary. "+
+		"The scan fails if the binary does not match, e.g. a tampered executable in PATH.")
+	rootCmd.Flags().IntVar(&maxEngineRestarts, "max-engine-restarts", 3, "Specify how many times a crashed BluBracket CLI "+
+		"process of a worker is restarted before the scan fails. Records not confirmed by the crashed process are scanned again.")
+	rootCmd.Flags().StringVar(&serverAddress, "server", "", "Specify address of a running BluBracket gRPC server to use "+
+		"instead of starting the BluBracket CLI, e.g. unix:///path/to/socket or host:port")
+	rootCmd.Flags().StringVar(&tlsCAPath, "tls-ca", "", "Specify PEM bundle of CA certificates to verify the --server. Else the system roots.")
+	rootCmd.Flags().StringVar(&tlsCertPath, "tls-cert", "", "Specify PEM client certificate for mutual TLS with the --server")
+	rootCmd.Flags().StringVar(&tlsKeyPath, "tls-key", "", "Specify PEM private key of the --tls-cert")
+	rootCmd.Flags().StringVar(&tlsServerName, "tls-server-name", "", "Specify server name to verify the --server certificate with, if it differs from the address")
+	rootCmd.Flags().StringSliceVar(&tlsPins, "tls-pin", nil, "Specify sha256 of the --server certificate public key (SPKI), in hex or base64. "+
+		"The connection fails if the server key is not one of the pinned keys.")
+	rootCmd.Flags().BoolVar(&insecureTransport, "insecure", false, "Connect to the --server without TLS. "+
+		"Record contents are sent in plaintext. Without this flag only unix sockets are used without TLS.")
+	rootCmd.Flags().DurationVar(&serverStartTimeout, "server-start-timeout", 30*time.Second,
+		"Specify how long to wait for the BluBracket CLI gRPC server, or the --server, to be ready")
+	rootCmd.Flags().StringVar(&rulesPath, "rules", "", "Specify yaml file with custom detection rules. "+
+		"Risks found by the rules are reported along with the risks found by the engine.")
+	rootCmd.Flags().BoolVar(&detectPII, "pii", false, "Detect PII validated by checksums and structure: "+
+		"payment cards (Luhn, BIN ranges), IBAN (mod-97), US SSN/ITIN, UK NINO, Canadian SIN, Spanish DNI and phone numbers (E.164).")
+	rootCmd.Flags().BoolVar(&detectEntropy, "entropy", false, "Detect high-randomness strings of unknown format "+
+		"(Category SECRET, Type high_entropy_string).")
+	rootCmd.Flags().StringToStringVar(&entropyThresholds, "entropy-threshold", nil,
+		fmt.Sprintf("Specify minimum Shannon entropy per alphabet (%s) for --entropy, e.g. base64=4.5,hex=3", supportedAlphabetsText))
+	rootCmd.Flags().StringToIntVar(&entropyMinLengths, "entropy-min-length", nil,
+		fmt.Sprintf("Specify minimum token length per alphabet (%s) for --entropy, e.g. base64=20,hex=32", supportedAlphabetsText))
+	rootCmd.Flags().BoolVar(&columnSemantics, "column-semantics", false, "Detect plaintext values in columns holding credentials. "+
+		"Columns are identified by name (e.g. password, api_key, secret) and comment. Values which are not password hashes, "+
+		"digests or encrypted are reported as plaintext_password.")
+	rootCmd.Flags().BoolVar(&hashAudit, "hash-audit", false, "Audit how the column values (credentials) are hashed. "+
+		"MD5/SHA-1/unsalted SHA-2 digests, low bcrypt cost and plaintext are reported as weak_password_hash, "+
+		"values shared by records as duplicate_password_hash, both with low severity. "+
+		"A summary of the column (algorithm distribution, weak percentage) is written to the output.")
+	rootCmd.Flags().IntVar(&minBcryptCost, "min-bcrypt-cost", 10, "Specify minimum bcrypt cost factor for --hash-audit")
+	rootCmd.Flags().StringVar(&suppressionsPath, "suppressions", "", "Specify yaml file with suppressions of known false positives. "+
+		"Suppressions match on table, column, recordId, risk type and sha256 of the value, with a mandatory reason and optional expiry date.")
+	rootCmd.Flags().BoolVar(&showSuppressed, "show-suppressed", false, "Write suppressed risks to the output with 'Suppressed' instead of dropping them")
+	rootCmd.Flags().StringVar(&baselinePath, "baseline", "", "Specify output of a previous scan (json lines) as baseline. "+
+		"Only risks not in the baseline are reported. Baseline risks not found again are written with 'Disappeared'.")
+	severitiesText := strings.Join(engine.Severities, ", ")
+	rootCmd.PersistentFlags().StringVar(&failOn, "fail-on", "", fmt.Sprintf("Exit with 1 if risks at or above the severity (%s) are found", severitiesText))
+	rootCmd.PersistentFlags().StringVar(&minSeverity, "min-severity", "", fmt.Sprintf("Report only risks at or above the severity (%s)", severitiesText))
+	rootCmd.PersistentFlags().StringSliceVar(&categories, "category", nil, "Report only risks of the categories, e.g. SECRET,PII")
+	rootCmd.MarkPersistentFlagRequired("uri")
 }
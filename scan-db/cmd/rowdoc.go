@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	pb "github.com/BluBracket/database-risk-scanner/grpc/api"
+	"github.com/BluBracket/database-risk-scanner/scan-db/detect"
+	"github.com/BluBracket/database-risk-scanner/scan-db/engine"
+)
+
+// rowDocumentSeparator separates the column label from the value in a row document line
+const rowDocumentSeparator = ": "
+
+// lineBreaks replaces the line breaks in a column value of a row document
+var lineBreaks = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ")
+
+// rowDocument returns the columns of a row as a document with a line per column,
+// labelled with the column name, e.g.
+//
+//	username: jeff
+//	password: hunter2
+//
+// line breaks in the values are replaced by spaces, so the line of a risk tells its column.
+// the values are also returned as fields for the correlation.
+func rowDocument(columns []string, texts []textType) (data []byte, fields []detect.Field) {
+	var buf bytes.Buffer
+	for i, c := range columns {
+		value := lineBreaks.Replace(string(texts[i].b))
+		buf.WriteString(c)
+		buf.WriteString(rowDocumentSeparator)
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		fields = append(fields, detect.Field{Name: c, Value: []byte(value)})
+	}
+	data = buf.Bytes()
+	return
+}
+
+// correlationAnalyzer finds risks made of the values of several columns of a row
+var correlationAnalyzer = detect.AnalyzerFunc(func(r detect.Record) ([]*pb.Risk, error) {
+	fields := make([]engine.Field, 0, len(r.Fields))
+	for _, f := range r.Fields {
+		fields = append(fields, engine.Field{Name: f.Name, Value: string(f.Value)})
+	}
+	return engine.Correlate(fields), nil
+})
+
+// rowDocumentColumn returns the column of a risk found in a row document.
+// correlated risks list their columns in the 'columns' tag. for other risks the column is given by the line,
+// and the line and column numbers are made relative to the column value.
+// risks spanning several lines are reported with all the scanned columns.
+// labelMade tells the risk is an assignment made by the label of a credential column, e.g. 'password: <bcrypt hash>'.
+// the value of a credential column is a risk only if it is plaintext, so such a risk is not reported.
+func rowDocumentColumn(risk *pb.Risk) (c string, labelMade bool) {
+	if v, ok := risk.Tags["columns"]; ok {
+		var participating []string
+		if json.Unmarshal([]byte(v), &participating) == nil {
+			return strings.Join(participating, ","), false
+		}
+	}
+	if risk.Line1 < 1 || int(risk.Line1) > len(rowColumns) || risk.Line2 != risk.Line1 {
+		return strings.Join(rowColumns, ","), false
+	}
+	c = rowColumns[risk.Line1-1]
+	if strings.HasSuffix(risk.Type, "_assignment") && engine.IsCredentialColumn(c, "") &&
+		engine.ClassifyCredential(risk.Value) != engine.ClassPlaintext {
+		return c, true
+	}
+	prefix := int32(len(c) + len(rowDocumentSeparator))
+	risk.Line1, risk.Line2 = 1, 1
+	if risk.Col1 > prefix {
+		risk.Col1 -= prefix
+		risk.Col2 -= prefix
+	}
+	return c, false
+}
+
+// rowDocumentRisk moves a risk found in the value of the i-th column of a row document to the document,
+// so rowDocumentColumn finds its column
+func rowDocumentRisk(risk *pb.Risk, i int, name string) {
+	prefix := int32(len(name) + len(rowDocumentSeparator))
+	risk.Line1 += int32(i)
+	risk.Line2 += int32(i)
+	risk.Col1 += prefix
+	risk.Col2 += prefix
+}
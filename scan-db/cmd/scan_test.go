@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/BluBracket/database-risk-scanner/grpc/api"
+	"github.com/BluBracket/database-risk-scanner/scan-db/detect"
+	"github.com/BluBracket/database-risk-scanner/scan-db/fakeserver"
+	"google.golang.org/grpc"
+)
+
+// passwordRisk is the risk the fake server finds in the notes of account 2
+var passwordRisk = &pb.Risk{Category: "SECRET", Type: "password_assignment", Severity: "high"}
+
+// findings collects the findings reported to its handler
+type findings struct {
+	mu   sync.Mutex
+	list []detect.Finding
+}
+
+func (f *findings) add(finding detect.Finding) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.list = append(f.list, finding)
+	return nil
+}
+
+func (f *findings) get() []detect.Finding {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]detect.Finding(nil), f.list...)
+}
+
+// accountRows selects the notes of the accounts of the sqlite fixture. account 3 has no notes.
+func accountRows(t *testing.T) *sql.Rows {
+	t.Helper()
+	dbType, uri = dbTypeEnum(dbTypeSqlite), "../_testdata/sqlite/accounts.db"
+	table, idColumn, column = "accounts", "id", "notes"
+	recordAccounting = detect.NewAccounting()
+	db, err := connectToDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.Table(table).Select(idColumn, column).Rows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rows.Close() })
+	return rows
+}
+
+// scanWithFakeServer scans the accounts on a stream to a fake server with the rules
+func scanWithFakeServer(t *testing.T, rules ...fakeserver.Rule) (found []detect.Finding, err error) {
+	t.Helper()
+	rows := accountRows(t)
+	s := fakeserver.New(rules...)
+	conn, err := s.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		s.Stop()
+	})
+	var f findings
+	d, err := detect.NewAccountedStream(context.Background(), pb.NewBluBracketClient(conn), f.add, recordAccounting)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = scanRows(context.Background(), rows, d)
+	return f.get(), err
+}
+
+func TestScanRowsReportsRisks(t *testing.T) {
+	found, err := scanWithFakeServer(t, fakeserver.Rule{Contains: "password=", Risks: []*pb.Risk{passwordRisk}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].RecordId != "2" || found[0].Key != "notes" || found[0].Risk.Type != passwordRisk.Type {
+		t.Fatalf("expected the risk of account 2, got %v", found)
+	}
+	summary := recordAccounting.Summary()
+	if summary.Sent != 2 || summary.Confirmed != 2 || len(summary.Unconfirmed) != 0 || len(summary.Anomalies) != 0 {
+		t.Fatalf("expected 2 records sent and confirmed, got %+v", summary)
+	}
+}
+
+func TestScanRowsWaitsForDelayedRisks(t *testing.T) {
+	const delay = 200 * time.Millisecond
+	start := time.Now()
+	found, err := scanWithFakeServer(t, fakeserver.Rule{Contains: "password=", Delay: delay, Risks: []*pb.Risk{passwordRisk}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 {
+		t.Fatalf("expected the delayed risk, got %v", found)
+	}
+	if time.Since(start) < delay {
+		t.Fatal("scan returned before the delayed risk")
+	}
+}
+
+func TestScanRowsFailsOnResponseWithoutMetadata(t *testing.T) {
+	found, err := scanWithFakeServer(t, fakeserver.Rule{Contains: "password=", NilMetadata: true, Risks: []*pb.Risk{passwordRisk}})
+	if err == nil || !strings.Contains(err.Error(), "without metadata") {
+		t.Fatalf("expected an error for the response without metadata, got %v", err)
+	}
+	if len(found) != 0 {
+		t.Fatalf("expected no risk, got %v", found)
+	}
+}
+
+func TestScanRowsRecordsRisksOfUnknownRecords(t *testing.T) {
+	found, err := scanWithFakeServer(t, fakeserver.Rule{Contains: "password=", Context: "42", Risks: []*pb.Risk{passwordRisk}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 0 {
+		t.Fatalf("expected the risk of the unknown record to be dropped, got %v", found)
+	}
+	summary := recordAccounting.Summary()
+	if len(summary.Anomalies) != 1 || !strings.Contains(summary.Anomalies[0], `unknown record id "42"`) {
+		t.Fatalf("expected an anomaly for the unknown record, got %v", summary.Anomalies)
+	}
+}
+
+// fakeProcess is an engine process which never exits
+type fakeProcess struct{}
+
+func (fakeProcess) exitError(time.Duration) error {
+	return nil
+}
+
+func (fakeProcess) stop() {}
+
+func TestSupervisedEngineReplaysAfterReset(t *testing.T) {
+	rows := accountRows(t)
+	s := fakeserver.New(
+		fakeserver.Rule{Contains: "password=", Reset: true, Times: 1},
+		fakeserver.Rule{Contains: "password=", Risks: []*pb.Risk{passwordRisk}},
+	)
+	defer s.Stop()
+	launches := 0
+	launch := func(ctx context.Context, worker int) (engineProcess, *grpc.ClientConn, error) {
+		launches++
+		conn, err := s.Dial()
+		return fakeProcess{}, conn, err
+	}
+	var f findings
+	ctx := context.Background()
+	d, err := startSupervisedEngine(ctx, ctx, launch, 0, f.add)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.stop()
+	_, err = scanRows(ctx, rows, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if launches != 2 {
+		t.Fatalf("expected the engine to be restarted once, got %d launch(es)", launches)
+	}
+	found := f.get()
+	if len(found) != 1 || found[0].RecordId != "2" {
+		t.Fatalf("expected the risk of account 2 once, got %v", found)
+	}
+	var replayed int
+	for _, stream := range s.Received() {
+		if stream.Metadata.Context == "2" {
+			replayed++
+		}
+	}
+	if replayed != 2 {
+		t.Fatalf("expected account 2 to be sent again after the reset, sent %d time(s)", replayed)
+	}
+	summary := recordAccounting.Summary()
+	if summary.Sent != 2 || summary.Confirmed != 2 {
+		t.Fatalf("expected 2 records sent and confirmed, got %+v", summary)
+	}
+}
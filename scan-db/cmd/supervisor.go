@@ -0,0 +1,281 @@
+package cmd
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	pb "github.com/BluBracket/database-risk-scanner/grpc/api"
+	"github.com/BluBracket/database-risk-scanner/scan-db/detect"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+)
+
+const (
+	// confirmBatchSize is the number of records sent on a stream before it drains and the next batch is sent
+	confirmBatchSize = 100
+	// firstRestartDelay is the wait before the first restart of an engine. it doubles up to maxRestartDelay.
+	firstRestartDelay = time.Second
+	maxRestartDelay   = 30 * time.Second
+	// exitWait is how long a failed engine process is waited for to exit, to report why it failed
+	exitWait = 500 * time.Millisecond
+)
+
+// supervisedEngine is a Detector using a BluBracket CLI process, which is restarted with backoff if it dies.
+// records are sent in batches, a stream per batch. a batch is confirmed once its stream ends, i.e. the engine sent
+// all the risks of the batch. the risks of a batch are held till it is confirmed. so when the engine dies, the risks
+// of the unconfirmed batches are dropped and their records are replayed on the restarted engine, without duplicates.
+// a full batch drains while the next batch is sent, so sending does not wait for the engine at every batch.
+// after '--max-engine-restarts' restarts, the detection fails.
+// it is not safe for concurrent use.
+type supervisedEngine struct {
+	launch  engineLauncher
+	worker  int
+	handler detect.Handler
+	// startCtx cancels starting the engine, streamCtx the streams
+	startCtx, streamCtx context.Context
+
+	server engineProcess
+	conn   *grpc.ClientConn
+	// batch is the batch being sent, draining the previous batch, sent and not confirmed yet
+	batch, draining *engineBatch
+	restarts        int
+	// restartDelay is the wait before the next restart. it is reset once a batch is confirmed.
+	restartDelay time.Duration
+}
+
+// engineBatch is a batch of records sent on a stream
+type engineBatch struct {
+	stream detect.Detector
+	// held holds the risks received on the stream
+	held *heldFindings
+	// records holds the records sent, to replay them if the engine dies
+	records []detect.Record
+	// closed receives the result of closing the stream, once the batch is draining
+	closed chan error
+}
+
+// engineProcess is a detection engine process, e.g. a BluBracket CLI process
+type engineProcess interface {
+	// exitError waits up to timeout for the process to exit and returns how it exited, or nil if it is still running
+	exitError(timeout time.Duration) error
+	// stop stops the process
+	stop()
+}
+
+// engineLauncher starts the engine process of the worker and establishes a connection to it
+type engineLauncher func(ctx context.Context, worker int) (engineProcess, *grpc.ClientConn, error)
+
+// cliLauncher returns an engineLauncher starting the BluBracket CLI binary
+func cliLauncher(bin string) engineLauncher {
+	return func(ctx context.Context, worker int) (p engineProcess, conn *grpc.ClientConn, err error) {
+		s, conn, err := startCLIServer(ctx, bin, worker)
+		if err != nil {
+			return
+		}
+		return s, conn, nil
+	}
+}
+
+// heldFindings holds the findings of a stream
+type heldFindings struct {
+	mu       sync.Mutex
+	findings []detect.Finding
+}
+
+func (h *heldFindings) add(f detect.Finding) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.findings = append(h.findings, f)
+	return nil
+}
+
+func (h *heldFindings) take() (findings []detect.Finding) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	findings, h.findings = h.findings, nil
+	return
+}
+
+// startSupervisedEngine starts the engine process of the worker and opens a stream to it
+func startSupervisedEngine(startCtx, streamCtx context.Context, launch engineLauncher, worker int, h detect.Handler) (s *supervisedEngine, err error) {
+	s = &supervisedEngine{launch: launch, worker: worker, handler: h, startCtx: startCtx, streamCtx: streamCtx, restartDelay: firstRestartDelay}
+	err = s.start()
+	if err != nil {
+		s = nil
+	}
+	return
+}
+
+func (s *supervisedEngine) start() (err error) {
+	s.server, s.conn, err = s.launch(s.startCtx, s.worker)
+	if err != nil {
+		return
+	}
+	return s.openStream()
+}
+
+// openStream opens a stream for the next batch. the risks received on it are held till the batch is confirmed.
+// risks of a failed stream are held apart and dropped.
+func (s *supervisedEngine) openStream() (err error) {
+	b := &engineBatch{held: &heldFindings{}}
+	b.stream, err = detect.NewAccountedStream(s.streamCtx, pb.NewBluBracketClient(s.conn), b.held.add, recordAccounting)
+	if err != nil {
+		return
+	}
+	s.batch = b
+	return
+}
+
+func (s *supervisedEngine) Submit(r detect.Record) (err error) {
+	// the batch may be replayed after the caller reused the data of r, so it keeps a copy
+	s.batch.records = append(s.batch.records, copyRecord(r))
+	err = s.batch.stream.Submit(r)
+	if err != nil {
+		// the restarted engine gets the unconfirmed records, including r
+		err = s.restart(err)
+		if err != nil {
+			return
+		}
+	}
+	if len(s.batch.records) < confirmBatchSize {
+		return
+	}
+	// the previous batch had the time to send the current one to drain
+	err = s.confirmDraining()
+	if err != nil {
+		return
+	}
+	s.drain()
+	return s.openStream()
+}
+
+// Close confirms the last batches
+func (s *supervisedEngine) Close() (err error) {
+	for s.batch != nil || s.draining != nil {
+		err = s.confirmDraining()
+		if err != nil {
+			return
+		}
+		s.drain()
+	}
+	return
+}
+
+// drain closes the send stream of the batch. the batch drains, i.e. its risks are received, while the next one is sent.
+func (s *supervisedEngine) drain() {
+	b := s.batch
+	s.batch = nil
+	if b == nil {
+		return
+	}
+	b.closed = make(chan error, 1)
+	go func() {
+		b.closed <- b.stream.Close()
+	}()
+	s.draining = b
+}
+
+// confirmDraining waits for all the risks of the draining batch and reports them to the handler.
+// if the engine dies meanwhile, the unconfirmed records are replayed on the restarted engine.
+func (s *supervisedEngine) confirmDraining() (err error) {
+	if s.draining == nil {
+		return
+	}
+	err = <-s.draining.closed
+	if err != nil {
+		return s.restart(err)
+	}
+	for _, f := range s.draining.held.take() {
+		err = s.handler(f)
+		if err != nil {
+			return
+		}
+	}
+	s.draining = nil
+	// the engine is healthy again, a later failure is restarted without waiting long
+	s.restartDelay = firstRestartDelay
+	return
+}
+
+// restart stops the failed engine, starts a new one and replays the unconfirmed records on it, as the current batch.
+// it returns the failure if the detection is cancelled or the restart budget is spent.
+func (s *supervisedEngine) restart(failure error) (err error) {
+	var records []detect.Record
+	if s.draining != nil {
+		records = append(records, s.draining.records...)
+	}
+	if s.batch != nil {
+		records = append(records, s.batch.records...)
+	}
+	s.batch, s.draining = nil, nil
+	for {
+		if s.streamCtx.Err() != nil || s.startCtx.Err() != nil {
+			return failure
+		}
+		if s.server != nil {
+			if exitErr := s.server.exitError(exitWait); exitErr != nil {
+				// the process died. its exit status and stderr tell why.
+				failure = exitErr
+			}
+		}
+		if s.restarts >= maxEngineRestarts {
+			return errors.Wrapf(failure, "detection engine failed after %d restart(s)", s.restarts)
+		}
+		s.restarts++
+		logger.warn("detection engine failed. restarting", "worker", s.worker, "error", failure,
+			"delay", s.restartDelay, "restart", s.restarts, "max_restarts", maxEngineRestarts)
+		s.stop()
+		select {
+		case <-time.After(s.restartDelay):
+		case <-s.startCtx.Done():
+			return failure
+		}
+		s.restartDelay *= 2
+		if s.restartDelay > maxRestartDelay {
+			s.restartDelay = maxRestartDelay
+		}
+		failure = s.start()
+		if failure == nil {
+			failure = s.replay(records)
+		}
+		if failure == nil {
+			return
+		}
+	}
+}
+
+// copyRecord returns a copy of the record owning its data
+func copyRecord(r detect.Record) detect.Record {
+	r.Data = append([]byte(nil), r.Data...)
+	fields := make([]detect.Field, len(r.Fields))
+	for i, f := range r.Fields {
+		fields[i] = detect.Field{Name: f.Name, Value: append([]byte(nil), f.Value...)}
+	}
+	r.Fields = fields
+	return r
+}
+
+// replay sends the records on the stream of the current batch
+func (s *supervisedEngine) replay(records []detect.Record) (err error) {
+	s.batch.records = records
+	for _, r := range records {
+		err = s.batch.stream.Submit(r)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// stop closes the connection and stops the engine process
+func (s *supervisedEngine) stop() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	if s.server != nil {
+		s.server.stop()
+		s.server = nil
+	}
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strings"
+	"time"
+
+	pb "github.com/BluBracket/database-risk-scanner/grpc/api"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// suppressionDateLayout is the layout of the suppression expiry date
+const suppressionDateLayout = "2006-01-02"
+
+// suppressionsFile is the format of the suppression file. for example:
+//
+//	suppressions:
+//	  - table: accounts
+//	    column: notes
+//	    recordId: "2"
+//	    type: password_assignment
+//	    valueHash: 5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8
+//	    reason: test account in staging fixture
+//	    expires: 2026-12-31
+type suppressionsFile struct {
+	Suppressions []*suppression `yaml:"suppressions"`
+}
+
+// suppression matches known false positives or accepted risks.
+// all the fields given must match the risk. reason is mandatory.
+type suppression struct {
+	Table    string `yaml:"table"`
+	Column   string `yaml:"column"`
+	RecordId string `yaml:"recordId"`
+	Type     string `yaml:"type"`
+	// ValueHash is the hex sha256 of the risk value
+	ValueHash string `yaml:"valueHash"`
+	Reason    string `yaml:"reason"`
+	// Expires is the date (yyyy-mm-dd) after which the suppression no longer applies
+	Expires string `yaml:"expires"`
+
+	expires time.Time
+}
+
+// suppressions is a set of suppression entries
+type suppressions []*suppression
+
+// loadSuppressions reads the suppression file.
+// expired entries are reported and not used.
+func loadSuppressions(path string) (list suppressions, err error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		err = errors.Wrap(err, "failed to read suppression file")
+		return
+	}
+	var f suppressionsFile
+	err = yaml.Unmarshal(b, &f)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to parse suppression file %s", path)
+		return
+	}
+	now := time.Now()
+	for i, s := range f.Suppressions {
+		err = s.validate()
+		if err != nil {
+			err = errors.Wrapf(err, "invalid suppression #%d in %s", i+1, path)
+			return
+		}
+		if !s.expires.IsZero() && now.After(s.expires) {
+			logger.warn("suppression expired", "suppression", i+1, "expires", s.Expires, "reason", s.Reason)
+			continue
+		}
+		list = append(list, s)
+	}
+	return
+}
+
+func (s *suppression) validate() (err error) {
+	if strings.TrimSpace(s.Reason) == "" {
+		return errors.New("reason is required")
+	}
+	if s.Table == "" && s.Column == "" && s.RecordId == "" && s.Type == "" && s.ValueHash == "" {
+		return errors.New("at least one of table, column, recordId, type or valueHash is required")
+	}
+	s.ValueHash = strings.ToLower(s.ValueHash)
+	if s.Expires != "" {
+		s.expires, err = time.Parse(suppressionDateLayout, s.Expires)
+		if err != nil {
+			return errors.Wrap(err, "invalid expires date")
+		}
+		// a suppression applies till the end of its expiry date
+		s.expires = s.expires.AddDate(0, 0, 1)
+	}
+	return
+}
+
+// match returns the first suppression matching the risk, or nil if the risk is not suppressed.
+func (list suppressions) match(table, column, recordId string, risk *pb.Risk) *suppression {
+	var valueHash string
+	for _, s := range list {
+		if s.Table != "" && s.Table != table ||
+			s.Column != "" && s.Column != column ||
+			s.RecordId != "" && s.RecordId != recordId ||
+			s.Type != "" && s.Type != risk.Type {
+			continue
+		}
+		if s.ValueHash != "" {
+			if valueHash == "" {
+				valueHash = hashValue(risk.Value)
+			}
+			if s.ValueHash != valueHash {
+				continue
+			}
+		}
+		return s
+	}
+	return nil
+}
+
+// hashValue returns the hex sha256 of a risk value
+func hashValue(value string) string {
+	h := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(h[:])
+}
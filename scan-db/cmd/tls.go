@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// tlsFlagsGiven tells if any of the TLS flags is given
+func tlsFlagsGiven() bool {
+	return tlsCAPath != "" || tlsCertPath != "" || tlsKeyPath != "" || tlsServerName != "" || len(tlsPins) > 0
+}
+
+// validateTLSFlags checks the TLS flags. they apply to '--server' only.
+func validateTLSFlags() (err error) {
+	if (tlsFlagsGiven() || insecureTransport) && serverAddress == "" {
+		return errors.New("--tls-* and --insecure flags require --server")
+	}
+	if insecureTransport && tlsFlagsGiven() {
+		return errors.New("--insecure can not be used with --tls-* flags")
+	}
+	if (tlsCertPath == "") != (tlsKeyPath == "") {
+		return errors.New("--tls-cert and --tls-key must be given together")
+	}
+	for _, pin := range tlsPins {
+		if _, err = decodePin(pin); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// serverCredentials returns the transport credentials to connect to the server at serverUri.
+// unix sockets are local, so plaintext is used for them unless TLS flags are given.
+// over the network TLS is used, unless '--insecure' flag is given.
+func serverCredentials(serverUri string) (creds credentials.TransportCredentials, err error) {
+	if insecureTransport || unixSocketPath(serverUri) != "" && !tlsFlagsGiven() {
+		return insecure.NewCredentials(), nil
+	}
+	config, err := tlsConfig()
+	if err != nil {
+		return
+	}
+	return credentials.NewTLS(config), nil
+}
+
+// tlsConfig returns the TLS configuration given by the flags: the CA bundle to verify the server,
+// the client certificate for mutual TLS, the server name and the pinned server keys.
+// the system roots are used if no CA bundle is given.
+func tlsConfig() (config *tls.Config, err error) {
+	config = &tls.Config{MinVersion: tls.VersionTLS12, ServerName: tlsServerName}
+	if tlsCAPath != "" {
+		var pem []byte
+		pem, err = os.ReadFile(tlsCAPath)
+		if err != nil {
+			err = errors.Wrap(err, "failed to read CA bundle")
+			return
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			err = errors.New("no certificates found in CA bundle " + tlsCAPath)
+			return
+		}
+	}
+	if tlsCertPath != "" {
+		var cert tls.Certificate
+		cert, err = tls.LoadX509KeyPair(tlsCertPath, tlsKeyPath)
+		if err != nil {
+			err = errors.Wrap(err, "failed to load client certificate")
+			return
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if len(tlsPins) > 0 {
+		pins := map[string]bool{}
+		for _, pin := range tlsPins {
+			var digest []byte
+			digest, err = decodePin(pin)
+			if err != nil {
+				return
+			}
+			pins[string(digest)] = true
+		}
+		config.VerifyPeerCertificate = verifyPins(pins)
+	}
+	return
+}
+
+// verifyPins returns a check that the server certificate public key is one of the pinned keys.
+// it runs after the usual verification of the certificate chain.
+func verifyPins(pins map[string]bool) func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("no server certificate")
+		}
+		cert, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return errors.Wrap(err, "failed to parse server certificate")
+		}
+		digest := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		if !pins[string(digest[:])] {
+			return errors.New("server certificate public key does not match --tls-pin. sha256: " +
+				base64.StdEncoding.EncodeToString(digest[:]))
+		}
+		return nil
+	}
+}
+
+// decodePin decodes the sha256 of a public key given in hex or base64, optionally prefixed with 'sha256/'
+func decodePin(pin string) (digest []byte, err error) {
+	p := strings.TrimPrefix(pin, "sha256/")
+	digest, err = hex.DecodeString(p)
+	if err != nil {
+		digest, err = base64.StdEncoding.DecodeString(p)
+	}
+	if err != nil || len(digest) != sha256.Size {
+		err = errors.New("invalid --tls-pin " + pin + ". expected sha256 of the server public key in hex or base64")
+	}
+	return
+}
@@ -0,0 +1,137 @@
+package detect
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Accounting accounts for the records sent on streams, so it can be shown that every record was analysed.
+// the engine sends responses for risks only, so a record is confirmed once its stream ends: the engine
+// analysed all the records of the stream, those without response are clean.
+// records are identified by id and stream name, i.e. key or else column.
+// the records with risks are marked with Found, by the handler of the findings of all the detectors.
+// it is safe for concurrent use.
+type Accounting struct {
+	mu      sync.Mutex
+	records map[recordRef]recordState
+	// anomalies describes the responses which can not be matched to a record sent, and the like
+	anomalies []string
+}
+
+// recordRef identifies a record sent on a stream
+type recordRef struct {
+	id, streamName string
+}
+
+// refOf returns the reference of the record. its stream name is its key, or else its column.
+func refOf(r Record) recordRef {
+	if r.Key != "" {
+		return recordRef{id: r.Id, streamName: r.Key}
+	}
+	return recordRef{id: r.Id, streamName: r.Column}
+}
+
+// recordState tells what is known about a record sent
+type recordState struct {
+	confirmed, withFindings bool
+}
+
+// AccountingSummary sums up the accounting of the records
+type AccountingSummary struct {
+	// Sent is the number of records sent
+	Sent int
+	// Confirmed is the number of records analysed
+	Confirmed int
+	// WithFindings is the number of records analysed with risk(s) marked with Found
+	WithFindings int
+	// Unconfirmed holds the ids of the records sent and not confirmed, e.g. lost when a stream failed
+	Unconfirmed []string
+	// Anomalies describes the responses which can not be matched to a record sent, and the like
+	Anomalies []string
+}
+
+// NewAccounting returns an empty Accounting
+func NewAccounting() *Accounting {
+	return &Accounting{records: map[recordRef]recordState{}}
+}
+
+// sent accounts for a record sent. a record sent again, e.g. replayed after a failure, is accounted once.
+func (a *Accounting) sent(ref recordRef) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.records[ref]; !ok {
+		a.records[ref] = recordState{}
+	}
+}
+
+// confirm confirms the records of a stream which ended
+func (a *Accounting) confirm(refs []recordRef) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, ref := range refs {
+		s := a.records[ref]
+		s.confirmed = true
+		a.records[ref] = s
+	}
+}
+
+// Found marks the record with the id and stream name, i.e. key or else column, as having risk(s).
+// a risk of a record which was not sent is recorded as an anomaly, so it does not count as a record sent.
+func (a *Accounting) Found(recordId, streamName string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ref := recordRef{id: recordId, streamName: streamName}
+	s, ok := a.records[ref]
+	if !ok {
+		a.anomalies = append(a.anomalies, fmt.Sprintf("risk found in record id %q (%s) which was not sent", recordId, streamName))
+		return
+	}
+	s.withFindings = true
+	a.records[ref] = s
+}
+
+// anomaly records an anomaly
+func (a *Accounting) anomaly(format string, args ...interface{}) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.anomalies = append(a.anomalies, fmt.Sprintf(format, args...))
+}
+
+// Summary sums up the accounting. unconfirmed record ids are sorted.
+func (a *Accounting) Summary() (s AccountingSummary) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s.Sent = len(a.records)
+	for ref, state := range a.records {
+		switch {
+		case !state.confirmed:
+			s.Unconfirmed = append(s.Unconfirmed, ref.id)
+		case state.withFindings:
+			s.Confirmed++
+			s.WithFindings++
+		default:
+			s.Confirmed++
+		}
+	}
+	sort.Strings(s.Unconfirmed)
+	s.Anomalies = append(s.Anomalies, a.anomalies...)
+	return
+}
+
+// Accounted returns a Detector accounting for the records as sent before submitting them to d, e.g. the streams
+// of the engine. so the risks found in a record by other detectors combined with Multi can be marked with Found,
+// even if d hands the record to a stream later, e.g. with Parallel.
+func Accounted(d Detector, a *Accounting) Detector {
+	return &accountedDetector{Detector: d, accounting: a}
+}
+
+type accountedDetector struct {
+	Detector
+	accounting *Accounting
+}
+
+func (d *accountedDetector) Submit(r Record) error {
+	d.accounting.sent(refOf(r))
+	return d.Detector.Submit(r)
+}
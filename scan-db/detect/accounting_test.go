@@ -0,0 +1,28 @@
+package detect
+
+import (
+	"strings"
+	"testing"
+
+	pb "github.com/BluBracket/database-risk-scanner/grpc/api"
+)
+
+func TestAccountingFound(t *testing.T) {
+	a := NewAccounting()
+	d := Accounted(FromAnalyzer(AnalyzerFunc(func(Record) ([]*pb.Risk, error) { return nil, nil }), nil), a)
+	for _, r := range []Record{{Id: "1", Column: "notes"}, {Id: "2", Key: "smtp_password"}} {
+		if err := d.Submit(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a.confirm([]recordRef{{id: "1", streamName: "notes"}, {id: "2", streamName: "smtp_password"}})
+	a.Found("1", "notes")
+	a.Found("3", "notes")
+	s := a.Summary()
+	if s.Sent != 2 || s.Confirmed != 2 || s.WithFindings != 1 || len(s.Unconfirmed) != 0 {
+		t.Fatalf("expected 2 records sent and analysed, 1 with risks, got %+v", s)
+	}
+	if len(s.Anomalies) != 1 || !strings.Contains(s.Anomalies[0], `record id "3" (notes) which was not sent`) {
+		t.Fatalf("expected an anomaly for the risk of record 3, got %v", s.Anomalies)
+	}
+}
@@ -0,0 +1,141 @@
+// Package detect defines the Detector interface used by scan-db to analyze records for risks.
+// the BluBracket gRPC AnalyzeStream is one implementation. other engines, composite detectors and
+// test doubles implement the same interface, so the scanner can be embedded with any of them.
+package detect
+
+import (
+	"sync"
+
+	pb "github.com/BluBracket/database-risk-scanner/grpc/api"
+)
+
+// Record is a unit of data submitted to a detector for analysis
+type Record struct {
+	// Id identifies the record. it is reported back with the findings for correlation.
+	Id string
+	// Column is the name of the column the data was read from, if any
+	Column string
+	// Key is the key the data is stored under, e.g. in a key/value table, if any.
+	// it tells what the data is, so detectors can use it as context.
+	Key string
+	// Data is the content to analyze
+	Data []byte
+	// Fields holds the named values the data is made of, e.g. the columns of a row document, if any
+	Fields []Field
+}
+
+// Field is a named value of a record
+type Field struct {
+	Name  string
+	Value []byte
+}
+
+// Finding is a risk found in a record
+type Finding struct {
+	// RecordId is the id of the record the risk was found in
+	RecordId string
+	// Key is the key of the record the risk was found in, if any
+	Key string
+	// Risk describes the risk found
+	Risk *pb.Risk
+}
+
+// Handler receives the findings of a detector.
+// it may be called concurrently from goroutines other than the one submitting records.
+// returning an error aborts the detection.
+type Handler func(f Finding) error
+
+// Detector analyzes records for risks.
+// records are submitted one by one and findings are reported asynchronously to the Handler
+// the detector was created with.
+type Detector interface {
+	// Submit submits a record for analysis
+	Submit(r Record) error
+	// Close flushes the submitted records and waits till all the findings are reported.
+	// no records can be submitted after Close.
+	Close() error
+}
+
+// Analyzer analyzes a record synchronously and returns the risks found
+type Analyzer interface {
+	Analyze(r Record) ([]*pb.Risk, error)
+}
+
+// AnalyzerFunc is an adapter to use a function as Analyzer
+type AnalyzerFunc func(r Record) ([]*pb.Risk, error)
+
+func (f AnalyzerFunc) Analyze(r Record) ([]*pb.Risk, error) {
+	return f(r)
+}
+
+// FromAnalyzer returns a Detector which runs the analyzer on each submitted record
+// and reports its risks to the handler before Submit returns.
+func FromAnalyzer(a Analyzer, h Handler) Detector {
+	return &analyzerDetector{analyzer: a, handler: h}
+}
+
+type analyzerDetector struct {
+	analyzer Analyzer
+	handler  Handler
+}
+
+func (d *analyzerDetector) Submit(r Record) (err error) {
+	risks, err := d.analyzer.Analyze(r)
+	if err != nil {
+		return
+	}
+	for _, risk := range risks {
+		err = d.handler(Finding{RecordId: r.Id, Key: r.Key, Risk: risk})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (d *analyzerDetector) Close() error {
+	return nil
+}
+
+// Multi returns a Detector which submits each record to all of the detectors.
+// findings of all the detectors are reported to their own handlers.
+func Multi(detectors ...Detector) Detector {
+	if len(detectors) == 1 {
+		return detectors[0]
+	}
+	return multiDetector(detectors)
+}
+
+type multiDetector []Detector
+
+func (m multiDetector) Submit(r Record) (err error) {
+	for _, d := range m {
+		err = d.Submit(r)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Close closes all the detectors and returns the first error, if any.
+func (m multiDetector) Close() (err error) {
+	for _, d := range m {
+		e := d.Close()
+		if err == nil {
+			err = e
+		}
+	}
+	return
+}
+
+// Synchronized returns a handler which serializes calls to h.
+// it is useful when findings of several detectors are written to the same output.
+func Synchronized(h Handler) Handler {
+	var mu sync.Mutex
+	return func(f Finding) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return h(f)
+	}
+}
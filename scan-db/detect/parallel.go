@@ -0,0 +1,83 @@
+package detect
+
+import (
+	"sync"
+)
+
+// Parallel returns a Detector which spreads the submitted records across the detectors,
+// e.g. streams to several engine instances. each detector is fed from its own goroutine
+// and takes the next record once it accepted the previous one, so a slow detector gets fewer records.
+// findings are reported to the handlers of the detectors, in no particular order.
+// the first error of a detector is returned by the following Submit calls and by Close.
+func Parallel(detectors ...Detector) Detector {
+	if len(detectors) == 1 {
+		return detectors[0]
+	}
+	p := &parallelDetector{detectors: detectors, records: make(chan Record), done: make(chan struct{})}
+	for _, d := range detectors {
+		p.wg.Add(1)
+		go p.feed(d)
+	}
+	return p
+}
+
+type parallelDetector struct {
+	detectors []Detector
+	records   chan Record
+	wg        sync.WaitGroup
+
+	mu  sync.Mutex
+	err error
+	// done is closed on the first error, so Submit does not block on failed detectors
+	done chan struct{}
+}
+
+func (p *parallelDetector) Submit(r Record) error {
+	select {
+	case p.records <- r:
+		return nil
+	case <-p.done:
+		return p.firstErr()
+	}
+}
+
+// Close closes all the detectors once the submitted records are taken and returns the first error, if any.
+func (p *parallelDetector) Close() (err error) {
+	close(p.records)
+	p.wg.Wait()
+	for _, d := range p.detectors {
+		p.fail(d.Close())
+	}
+	return p.firstErr()
+}
+
+// feed submits the records to the detector till the records are closed or a detector fails
+func (p *parallelDetector) feed(d Detector) {
+	defer p.wg.Done()
+	for r := range p.records {
+		err := d.Submit(r)
+		if err != nil {
+			p.fail(err)
+			return
+		}
+	}
+}
+
+// fail keeps the first error and stops accepting records
+func (p *parallelDetector) fail(err error) {
+	if err == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err == nil {
+		p.err = err
+		close(p.done)
+	}
+}
+
+func (p *parallelDetector) firstErr() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
@@ -0,0 +1,137 @@
+package detect
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	pb "github.com/BluBracket/database-risk-scanner/grpc/api"
+	"github.com/pkg/errors"
+)
+
+// streamDetector is a Detector using the BluBracket AnalyzeStream gRPC method.
+// each record is sent as a metadata msg with the record id as context followed by a data msg.
+// the risks received are matched back to the records sent by the metadata context and stream name.
+type streamDetector struct {
+	stream     pb.BluBracket_AnalyzeStreamClient
+	errCh      chan error
+	accounting *Accounting
+
+	mu sync.Mutex
+	// refs holds the records sent on the stream in order, to confirm them once the stream ends.
+	// sent holds the same records, to match the risks received to them.
+	refs []recordRef
+	sent map[recordRef]bool
+}
+
+// NewStream opens an AnalyzeStream on the BluBracket client and returns it as a Detector.
+// risks received on the stream are reported to the handler from a separate goroutine.
+func NewStream(ctx context.Context, client pb.BluBracketClient, h Handler) (d Detector, err error) {
+	return NewAccountedStream(ctx, client, h, NewAccounting())
+}
+
+// NewAccountedStream is NewStream accounting for the records sent on the stream, see Accounting.
+func NewAccountedStream(ctx context.Context, client pb.BluBracketClient, h Handler, a *Accounting) (d Detector, err error) {
+	c, err := client.AnalyzeStream(ctx)
+	if err != nil {
+		err = errors.Wrap(err, "AnalyzeStream call failed")
+		return
+	}
+	s := &streamDetector{stream: c, errCh: make(chan error, 1), accounting: a,
+		sent: map[recordRef]bool{}}
+	// read response(s) on stream while sending data
+	go s.readRisks(h)
+	d = s
+	return
+}
+
+// Submit sends metadata and data msg on the stream.
+// the record key, or else the column, is sent as stream name, so the engine can use it as context for detection.
+func (s *streamDetector) Submit(r Record) (err error) {
+	ref := refOf(r)
+	streamName := ref.streamName
+	// account for the record before sending it, as its risks may be received before Send returns
+	s.mu.Lock()
+	if s.sent[ref] {
+		s.accounting.anomaly("record id %q (%s) sent more than once, its risks can not be told apart", r.Id, streamName)
+	} else {
+		s.sent[ref] = true
+		s.refs = append(s.refs, ref)
+	}
+	s.mu.Unlock()
+	s.accounting.sent(ref)
+	// send metadata msg
+	err = s.stream.Send(&pb.AnalyzeStreamRequest{Metadata: &pb.AnalyzeStreamMetadata{StreamName: streamName, Context: r.Id}})
+	if err != nil {
+		err = errors.Wrap(err, "failed to send metadata msg")
+		return
+	}
+	// send data msg
+	err = s.stream.Send(&pb.AnalyzeStreamRequest{Data: r.Data})
+	if err != nil {
+		err = errors.Wrap(err, "failed to send data msg")
+		return
+	}
+	return
+}
+
+// Close closes the send stream and waits till all the risks are received.
+// once the stream ended, the records sent are confirmed: the engine analysed them all.
+func (s *streamDetector) Close() (err error) {
+	err = s.stream.CloseSend()
+	if err != nil {
+		err = errors.Wrap(err, "failed to close send stream")
+		return
+	}
+	err = <-s.errCh
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accounting.confirm(s.refs)
+	return
+}
+
+// readRisks receive response(s) containing risk found and reports them to the handler
+// with the record id and key sent back in the response metadata. the key of a record without one
+// is its column. a response without metadata or risk fails the stream.
+// a risk of a record not sent on the stream can not be correlated: it is recorded as an anomaly and dropped.
+func (s *streamDetector) readRisks(h Handler) {
+	var err error
+	defer func() {
+		s.errCh <- err
+		close(s.errCh)
+	}()
+
+	for {
+		var asResponse *pb.AnalyzeStreamResponse
+		asResponse, err = s.stream.Recv()
+		if err == io.EOF {
+			err = nil
+			break
+		}
+		if err != nil {
+			err = errors.Wrap(err, "failed receiving data from server")
+			return
+		}
+		// a malformed response can not be correlated to a record
+		if asResponse.Metadata == nil || asResponse.Risk == nil {
+			err = errors.New("received response without metadata or risk")
+			return
+		}
+		ref := recordRef{id: asResponse.Metadata.Context, streamName: asResponse.Metadata.StreamName}
+		s.mu.Lock()
+		known := s.sent[ref]
+		s.mu.Unlock()
+		if !known {
+			s.accounting.anomaly("risk %s received for unknown record id %q (%s)",
+				asResponse.Risk.Type, ref.id, ref.streamName)
+			continue
+		}
+		err = h(Finding{RecordId: asResponse.Metadata.Context, Key: asResponse.Metadata.StreamName, Risk: asResponse.Risk})
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package engine
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	pb "github.com/BluBracket/database-risk-scanner/grpc/api"
+)
+
+// Field is a named value of a row, e.g. a column
+type Field struct {
+	Name  string
+	Value string
+}
+
+// pii elements of a row recognised by the correlation
+const (
+	elementName     = "name"
+	elementDob      = "date_of_birth"
+	elementNationId = "national_id"
+	elementAddress  = "address"
+	elementEmail    = "email"
+	elementPhone    = "phone"
+)
+
+var (
+	usernameColumn = regexp.MustCompile(`(?i)(^|[_\-.])(user(_?name)?|login|email|e_?mail|account|uid|principal)([_\-.]|$)`)
+	nameColumn     = regexp.MustCompile(`(?i)(^|[_\-.])(full_?name|first_?name|given_?name|last_?name|sur_?name|family_?name|name)$`)
+	dobColumn      = regexp.MustCompile(`(?i)(^|[_\-.])(dob|birth_?date|date_?of_?birth|birthday|born(_on)?)$`)
+	nationIdColumn = regexp.MustCompile(`(?i)(^|[_\-.])(ssn|social_?security(_?number)?|nino|national_?id|sin|tax_?id|tin|itin|passport(_?(no|number))?|dni)$`)
+	addressColumn  = regexp.MustCompile(`(?i)(^|[_\-.])(address|street|address_?line_?\d?|postal_?address|home_?address)$`)
+	emailValue     = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[A-Za-z]{2,}$`)
+	// dateLayouts are the accepted layouts of a date of birth
+	dateLayouts = []string{"2006-01-02", "01/02/2006", "02/01/2006", "2006/01/02", "02.01.2006", time.RFC3339, "2006-01-02 15:04:05"}
+)
+
+// Correlate looks for risks made of the values of several fields of a row:
+// a credential pair (a username and a plaintext password) and a PII bundle
+// (a name with a date of birth and a national id, or with two other personal details).
+// correlated risks are more severe than the risks of the single values.
+// the participating fields are listed in the 'columns' tag.
+func Correlate(fields []Field) (risks []*pb.Risk) {
+	if r := credentialPair(fields); r != nil {
+		risks = append(risks, r)
+	}
+	if r := piiBundle(fields); r != nil {
+		risks = append(risks, r)
+	}
+	return
+}
+
+// credentialPair returns a critical risk if the row has a username and a plaintext password
+func credentialPair(fields []Field) *pb.Risk {
+	var user, password *Field
+	for i := range fields {
+		f := &fields[i]
+		v := strings.TrimSpace(f.Value)
+		if v == "" {
+			continue
+		}
+		switch {
+		case password == nil && IsCredentialColumn(f.Name, "") && ClassifyCredential(v) == ClassPlaintext:
+			password = f
+		case user == nil && usernameColumn.MatchString(f.Name) && !IsCredentialColumn(f.Name, ""):
+			user = f
+		}
+	}
+	if user == nil || password == nil {
+		return nil
+	}
+	return &pb.Risk{
+		Category:       "SECRET",
+		Type:           "credential_pair",
+		Severity:       "critical",
+		Value:          strings.TrimSpace(password.Value),
+		TextualContext: user.Name + ": " + strings.TrimSpace(user.Value),
+		Tags: map[string]string{
+			"columns":  jsonValue([]string{user.Name, password.Name}),
+			"username": jsonString(strings.TrimSpace(user.Value)),
+		},
+	}
+}
+
+// piiBundle returns a risk if the row identifies a person: critical for a name with a date of birth
+// and a national id, high for a name with two other personal details.
+func piiBundle(fields []Field) *pb.Risk {
+	elements := map[string]string{}
+	for _, f := range fields {
+		v := strings.TrimSpace(f.Value)
+		if v == "" {
+			continue
+		}
+		element := piiElement(f.Name, v)
+		if element != "" && elements[element] == "" {
+			elements[element] = f.Name
+		}
+	}
+	if elements[elementName] == "" || len(elements) < 3 {
+		return nil
+	}
+	severity := "high"
+	if elements[elementDob] != "" && elements[elementNationId] != "" {
+		severity = "critical"
+	}
+	var names, columns []string
+	for element, column := range elements {
+		names = append(names, element)
+		columns = append(columns, column)
+	}
+	sort.Strings(names)
+	sort.Strings(columns)
+	return &pb.Risk{
+		Category: "PII",
+		Type:     "pii_bundle",
+		Severity: severity,
+		Value:    strings.Join(names, ","),
+		Tags: map[string]string{
+			"columns":  jsonValue(columns),
+			"elements": jsonValue(names),
+		},
+	}
+}
+
+// piiElement returns the personal detail held by the field, if any
+func piiElement(name, value string) string {
+	switch {
+	case nameColumn.MatchString(name):
+		return elementName
+	case dobColumn.MatchString(name) && isDate(value):
+		return elementDob
+	case nationIdColumn.MatchString(name):
+		return elementNationId
+	case addressColumn.MatchString(name):
+		return elementAddress
+	case emailValue.MatchString(value):
+		return elementEmail
+	}
+	for _, r := range ScanPII([]byte(value)) {
+		switch r.Type {
+		case "us_ssn", "us_itin", "uk_nino", "ca_sin", "es_dni":
+			return elementNationId
+		case "phone_number":
+			return elementPhone
+		}
+	}
+	return ""
+}
+
+func isDate(value string) bool {
+	for _, layout := range dateLayouts {
+		if _, err := time.Parse(layout, value); err == nil {
+			return true
+		}
+	}
+	return false
+}
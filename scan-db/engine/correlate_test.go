@@ -0,0 +1,45 @@
+package engine
+
+import "testing"
+
+func TestCorrelate(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []Field
+		// risks holds the expected type and severity of the risks
+		risks [][2]string
+	}{
+		{"credential pair", []Field{{"username", "alice"}, {"password", "hunter2"}},
+			[][2]string{{"credential_pair", "critical"}}},
+		{"hashed password", []Field{{"username", "alice"}, {"password", "5f4dcc3b5aa765d61d8327deb882cf99"}}, nil},
+		{"password without username", []Field{{"notes", "alice"}, {"password", "hunter2"}}, nil},
+		{"empty username", []Field{{"username", " "}, {"password", "hunter2"}}, nil},
+		{"name, date of birth and national id", []Field{{"full_name", "Alice Smith"}, {"dob", "1980-02-29"}, {"ssn", "123-45-6789"}},
+			[][2]string{{"pii_bundle", "critical"}}},
+		{"name with email and phone", []Field{{"name", "Alice Smith"}, {"contact", "alice@example.com"}, {"mobile", "+44 20 7946 0958"}},
+			[][2]string{{"pii_bundle", "high"}}},
+		{"name with a detail", []Field{{"name", "Alice Smith"}, {"dob", "1980-02-29"}}, nil},
+		{"details without name", []Field{{"dob", "1980-02-29"}, {"ssn", "123-45-6789"}, {"address", "1 Main St"}}, nil},
+		{"date of birth which is not a date", []Field{{"name", "Alice Smith"}, {"dob", "unknown"}, {"ssn", "123-45-6789"}}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			risks := Correlate(test.fields)
+			if len(risks) != len(test.risks) {
+				t.Fatalf("expected %d risk(s), got %v", len(test.risks), risks)
+			}
+			for i, r := range risks {
+				if r.Type != test.risks[i][0] || r.Severity != test.risks[i][1] {
+					t.Fatalf("expected %s %s, got %s %s", test.risks[i][1], test.risks[i][0], r.Severity, r.Type)
+				}
+			}
+		})
+	}
+}
+
+func TestCorrelateColumns(t *testing.T) {
+	risks := Correlate([]Field{{"login", "alice"}, {"email", "alice@example.com"}, {"user_pwd", "hunter2"}})
+	if len(risks) != 1 || risks[0].Tags["columns"] != `["login","user_pwd"]` || risks[0].Tags["username"] != `"alice"` {
+		t.Fatalf("expected a credential pair of login and user_pwd, got %v", risks)
+	}
+}
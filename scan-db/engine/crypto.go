@@ -0,0 +1,189 @@
+package engine
+
+import (
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+	"time"
+
+	pb "github.com/BluBracket/database-risk-scanner/grpc/api"
+	"golang.org/x/crypto/ssh"
+)
+
+// EnrichCrypto parses the cryptographic material in the risk value, i.e. a PEM private key,
+// a X.509 certificate or a JWT, and adds its attributes to the risk tags:
+// key type and size for keys, subject, issuer and expiry for certificates and
+// algorithm, issuer, audience and expiry for JWTs.
+// an unsigned JWT (alg none) raises the severity to high, a higher severity is kept.
+// it returns false if the value is not a cryptographic object which can be parsed.
+func EnrichCrypto(risk *pb.Risk) bool {
+	var tags map[string]interface{}
+	value := strings.TrimSpace(risk.Value)
+	switch {
+	case strings.Contains(value, "-----BEGIN"):
+		tags = pemDetails(value)
+	case strings.HasPrefix(value, "eyJ"):
+		tags = jwtDetails(value)
+		if tags != nil && strings.EqualFold(tags["alg"].(string), "none") &&
+			SeverityRank(risk.Severity) < SeverityRank("high") {
+			risk.Severity = "high"
+		}
+	}
+	if tags == nil {
+		return false
+	}
+	if risk.Tags == nil {
+		risk.Tags = map[string]string{}
+	}
+	for k, v := range tags {
+		risk.Tags[k] = jsonValue(v)
+	}
+	return true
+}
+
+// pemDetails parses the first PEM block of the value.
+// escaped line breaks, e.g. of a key stored in a json document, are unescaped before parsing.
+func pemDetails(value string) (tags map[string]interface{}) {
+	value = strings.ReplaceAll(value, `\n`, "\n")
+	block, _ := pem.Decode([]byte(value[strings.Index(value, "-----BEGIN"):]))
+	if block == nil {
+		return
+	}
+	tags = map[string]interface{}{"pemType": block.Type}
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return
+		}
+		tags["subject"] = cert.Subject.String()
+		tags["issuer"] = cert.Issuer.String()
+		tags["notBefore"] = cert.NotBefore.UTC().Format(time.RFC3339)
+		tags["notAfter"] = cert.NotAfter.UTC().Format(time.RFC3339)
+		tags["expired"] = time.Now().After(cert.NotAfter)
+		tags["selfSigned"] = cert.Subject.String() == cert.Issuer.String()
+		tags["isCA"] = cert.IsCA
+		addKeyDetails(tags, cert.PublicKey)
+	case "ENCRYPTED PRIVATE KEY":
+		tags["encrypted"] = true
+	case "RSA PRIVATE KEY", "EC PRIVATE KEY", "DSA PRIVATE KEY":
+		if x509.IsEncryptedPEMBlock(block) {
+			tags["encrypted"] = true
+			return
+		}
+		key, err := parsePrivateKey(block)
+		if err == nil {
+			tags["encrypted"] = false
+			addKeyDetails(tags, key)
+		}
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err == nil {
+			tags["encrypted"] = false
+			addKeyDetails(tags, key)
+		}
+	case "OPENSSH PRIVATE KEY":
+		key, err := ssh.ParseRawPrivateKey(pem.EncodeToMemory(block))
+		if _, ok := err.(*ssh.PassphraseMissingError); ok {
+			tags["encrypted"] = true
+			return
+		}
+		if err == nil {
+			tags["encrypted"] = false
+			addKeyDetails(tags, key)
+		}
+	}
+	return
+}
+
+func parsePrivateKey(block *pem.Block) (key interface{}, err error) {
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	return ssh.ParseRawPrivateKey(pem.EncodeToMemory(block))
+}
+
+// addKeyDetails adds type and size of a public or private key to the tags.
+// the size of an EC key is given by its curve.
+func addKeyDetails(tags map[string]interface{}, key interface{}) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		tags["keyType"], tags["keySize"] = "rsa", k.N.BitLen()
+	case *rsa.PublicKey:
+		tags["keyType"], tags["keySize"] = "rsa", k.N.BitLen()
+	case *ecdsa.PrivateKey:
+		tags["keyType"], tags["keySize"], tags["curve"] = "ecdsa", k.Curve.Params().BitSize, k.Curve.Params().Name
+	case *ecdsa.PublicKey:
+		tags["keyType"], tags["keySize"], tags["curve"] = "ecdsa", k.Curve.Params().BitSize, k.Curve.Params().Name
+	case ed25519.PrivateKey, *ed25519.PrivateKey, ed25519.PublicKey:
+		tags["keyType"], tags["keySize"] = "ed25519", 256
+	case *dsa.PrivateKey:
+		tags["keyType"], tags["keySize"] = "dsa", k.P.BitLen()
+	case *dsa.PublicKey:
+		tags["keyType"], tags["keySize"] = "dsa", k.P.BitLen()
+	}
+}
+
+// jwtDetails decodes the header and claims of a JWT. the signature is not verified.
+func jwtDetails(value string) (tags map[string]interface{}) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 3 {
+		return
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	var claims struct {
+		Iss string          `json:"iss"`
+		Sub string          `json:"sub"`
+		Aud json.RawMessage `json:"aud"`
+		Exp *float64        `json:"exp"`
+	}
+	if decodeJwtPart(parts[0], &header) != nil || decodeJwtPart(parts[1], &claims) != nil {
+		return
+	}
+	tags = map[string]interface{}{"alg": header.Alg}
+	if strings.EqualFold(header.Alg, "none") {
+		tags["unsigned"] = true
+	}
+	if header.Kid != "" {
+		tags["kid"] = header.Kid
+	}
+	if claims.Iss != "" {
+		tags["issuer"] = claims.Iss
+	}
+	if claims.Sub != "" {
+		tags["subject"] = claims.Sub
+	}
+	if len(claims.Aud) > 0 {
+		// audience is a string or an array of strings
+		var aud interface{}
+		if json.Unmarshal(claims.Aud, &aud) == nil {
+			tags["audience"] = aud
+		}
+	}
+	if claims.Exp != nil {
+		exp := time.Unix(int64(*claims.Exp), 0).UTC()
+		tags["expiresAt"] = exp.Format(time.RFC3339)
+		tags["expired"] = time.Now().After(exp)
+	}
+	return
+}
+
+func decodeJwtPart(part string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(part, "="))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
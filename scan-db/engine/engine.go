@@ -0,0 +1,63 @@
+// Package engine is a native detection engine implementing the BluBracket gRPC service in Go.
+// it is used in-process when the blubracket CLI is not available.
+package engine
+
+import (
+	"io"
+
+	pb "github.com/BluBracket/database-risk-scanner/grpc/api"
+	"github.com/pkg/errors"
+)
+
+// Server implements pb.BluBracketServer using a rule set
+type Server struct {
+	pb.UnimplementedBluBracketServer
+	rules Rules
+}
+
+// NewServer returns a Server detecting risks with the rules
+func NewServer(rules Rules) *Server {
+	return &Server{rules: rules}
+}
+
+// AnalyzeStream analyzes the streams of data sent on the request stream.
+// each stream starts with a metadata msg followed by data msgs. a stream is analyzed once all its
+// data is received, i.e. when the next metadata msg arrives or the request stream is closed.
+// risks are sent back with the metadata of the stream for correlation.
+func (s *Server) AnalyzeStream(stream pb.BluBracket_AnalyzeStreamServer) (err error) {
+	var metadata *pb.AnalyzeStreamMetadata
+	var data []byte
+	for {
+		var req *pb.AnalyzeStreamRequest
+		req, err = stream.Recv()
+		if err == io.EOF {
+			return s.analyze(stream, metadata, data)
+		}
+		if err != nil {
+			return
+		}
+		if req.Metadata != nil {
+			err = s.analyze(stream, metadata, data)
+			if err != nil {
+				return
+			}
+			metadata, data = req.Metadata, nil
+		}
+		data = append(data, req.Data...)
+	}
+}
+
+// analyze scans data of a stream and sends the risks found
+func (s *Server) analyze(stream pb.BluBracket_AnalyzeStreamServer, metadata *pb.AnalyzeStreamMetadata, data []byte) (err error) {
+	if metadata == nil || len(data) == 0 {
+		return
+	}
+	for _, risk := range s.rules.Scan(data) {
+		err = stream.Send(&pb.AnalyzeStreamResponse{Risk: risk, Metadata: metadata})
+		if err != nil {
+			err = errors.Wrap(err, "failed to send risk")
+			return
+		}
+	}
+	return
+}
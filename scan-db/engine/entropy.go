@@ -0,0 +1,160 @@
+package engine
+
+import (
+	"encoding/base64"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	pb "github.com/BluBracket/database-risk-scanner/grpc/api"
+)
+
+// alphabets of the candidate tokens of the entropy detector
+const (
+	AlphabetBase64       = "base64"
+	AlphabetHex          = "hex"
+	AlphabetAlphanumeric = "alnum"
+)
+
+// Alphabets are the supported alphabets
+var Alphabets = []string{AlphabetBase64, AlphabetHex, AlphabetAlphanumeric}
+
+// EntropyThreshold is the minimum entropy and length for a token of an alphabet to be reported
+type EntropyThreshold struct {
+	// MinEntropy is the minimum Shannon entropy in bits per char
+	MinEntropy float64
+	// MinLength is the minimum length of the token
+	MinLength int
+}
+
+// EntropyConfig holds the entropy thresholds per alphabet
+type EntropyConfig map[string]EntropyThreshold
+
+// DefaultEntropyConfig returns the default thresholds.
+// max entropy of a random token is 4 bits per char for hex, ~5.95 for alphanumeric and 6 for base64,
+// but short tokens can not reach the max, so thresholds are well below it.
+func DefaultEntropyConfig() EntropyConfig {
+	return EntropyConfig{
+		AlphabetBase64:       {MinEntropy: 4.5, MinLength: 20},
+		AlphabetHex:          {MinEntropy: 3.0, MinLength: 32},
+		AlphabetAlphanumeric: {MinEntropy: 4.0, MinLength: 20},
+	}
+}
+
+var (
+	// entropyToken matches the candidate tokens. url-safe base64 chars are included.
+	entropyToken = regexp.MustCompile(`[A-Za-z0-9+/_\-]{8,}={0,2}`)
+	hexToken     = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+	alnumToken   = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+	uuidToken    = regexp.MustCompile(`(?i)^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+	// pemBlock matches PEM encoded blocks, e.g. certificates. their base64 content is not reported.
+	pemBlock = regexp.MustCompile(`-----BEGIN [A-Z0-9 ]+-----[\s\S]*?-----END [A-Z0-9 ]+-----`)
+	// hashContext are the words on a line telling a hex token of a digest length is a digest.
+	// they are whole words, so e.g. 'shared' or 'hashed_pw' do not hide a secret.
+	hashContext = regexp.MustCompile(`(?i)\b(md5|sha-?\d*|hash|checksum|digest|etag|commit|fingerprint)\b`)
+	// hashLengths are hex lengths of md5, sha1, sha224, sha256, sha384 and sha512 digests
+	hashLengths = []int{32, 40, 56, 64, 96, 128}
+)
+
+// ScanEntropy finds high-randomness tokens in data which may be secrets of unknown format.
+// entropy is measured for the alphabet of each token (base64, hex or alphanumeric) against the thresholds in config.
+// UUIDs, digests, PEM blocks, JWTs and base64 encoded text are not reported.
+// risks have category SECRET and type high_entropy_string, with 'alphabet' and 'entropy' in the tags.
+func ScanEntropy(data []byte, config EntropyConfig) (risks []*pb.Risk) {
+	var masked [][]int
+	for _, m := range pemBlock.FindAllIndex(data, -1) {
+		masked = append(masked, m)
+	}
+	for _, m := range entropyToken.FindAllIndex(data, -1) {
+		start, end := m[0], m[1]
+		if inRanges(masked, start) {
+			continue
+		}
+		token := string(data[start:end])
+		alphabet := alphabetOf(token)
+		threshold, ok := config[alphabet]
+		if !ok || len(token) < threshold.MinLength || !mixed(token) {
+			continue
+		}
+		e := Entropy(token)
+		if e < threshold.MinEntropy || wellKnown(token, alphabet, lineAt(data, start)) {
+			continue
+		}
+		line1, col1 := lineCol(data, start)
+		line2, col2 := lineCol(data, end)
+		risks = append(risks, &pb.Risk{
+			Category:       "SECRET",
+			Type:           "high_entropy_string",
+			Severity:       "medium",
+			Value:          token,
+			TextualContext: lineAt(data, start),
+			Line1:          line1,
+			Col1:           col1,
+			Line2:          line2,
+			Col2:           col2,
+			Tags: map[string]string{
+				"alphabet": jsonString(alphabet),
+				"entropy":  strconv.FormatFloat(e, 'f', 2, 64),
+			},
+		})
+	}
+	return
+}
+
+// alphabetOf returns the smallest alphabet of the token
+func alphabetOf(token string) string {
+	switch {
+	case hexToken.MatchString(token):
+		return AlphabetHex
+	case alnumToken.MatchString(token):
+		return AlphabetAlphanumeric
+	default:
+		return AlphabetBase64
+	}
+}
+
+// mixed tells if the token has both letters and digits. words, identifiers and numbers are not random.
+func mixed(token string) bool {
+	return strings.IndexFunc(token, unicode.IsLetter) >= 0 && strings.IndexFunc(token, unicode.IsDigit) >= 0
+}
+
+// wellKnown tells if the token is a UUID, a digest, a JWT or base64 encoded text.
+// a hex token is a digest if it has a digest length and is on a line telling so, as many secrets are
+// random hex of the same lengths.
+func wellKnown(token, alphabet, line string) bool {
+	if uuidToken.MatchString(token) || strings.HasPrefix(token, "eyJ") {
+		return true
+	}
+	if alphabet == AlphabetHex && containsInt(hashLengths, len(token)) && hashContext.MatchString(line) {
+		return true
+	}
+	if alphabet != AlphabetHex {
+		if b, err := base64.StdEncoding.DecodeString(token); err == nil && printable(b) {
+			return true
+		}
+		if b, err := base64.URLEncoding.DecodeString(token); err == nil && printable(b) {
+			return true
+		}
+	}
+	return false
+}
+
+// printable tells if b is printable ascii text
+func printable(b []byte) bool {
+	for _, c := range b {
+		if (c < 0x20 || c > 0x7e) && c != '\n' && c != '\r' && c != '\t' {
+			return false
+		}
+	}
+	return len(b) > 0
+}
+
+func inRanges(ranges [][]int, offset int) bool {
+	for _, r := range ranges {
+		if offset >= r[0] && offset < r[1] {
+			return true
+		}
+	}
+	return false
+}
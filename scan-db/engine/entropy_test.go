@@ -0,0 +1,41 @@
+package engine
+
+import "testing"
+
+func TestScanEntropy(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		found string
+	}{
+		{"hex secret of md5 length", "api_secret = 7bdf19a651038775bb8e48e95e81f0e7", "7bdf19a651038775bb8e48e95e81f0e7"},
+		{"hex secret of sha1 length", "8318ceadb7d57a5f9a897156cd9977af8f456e02", "8318ceadb7d57a5f9a897156cd9977af8f456e02"},
+		{"md5 digest", "md5: 7bdf19a651038775bb8e48e95e81f0e7", ""},
+		{"commit", "commit 8318ceadb7d57a5f9a897156cd9977af8f456e02", ""},
+		{"hex of another length in hash context", "hash e6591ba444a85b435cd2793d0ffbb92d9f4d", "e6591ba444a85b435cd2793d0ffbb92d9f4d"},
+		{"shared is not sha", "shared_key=7bdf19a651038775bb8e48e95e81f0e7", "7bdf19a651038775bb8e48e95e81f0e7"},
+		{"hashed_pw is not hash", "hashed_pw 7bdf19a651038775bb8e48e95e81f0e7", "7bdf19a651038775bb8e48e95e81f0e7"},
+		{"base64 token", "token: 1G2be3bbF94bEguLowNXRMVBdRhMQqxpj63EydQO", "1G2be3bbF94bEguLowNXRMVBdRhMQqxpj63EydQO"},
+		{"uuid", "id 3f2504e0-4f89-11d3-9a0c-0305e82c3301", ""},
+		{"base64 encoded text", "aGVsbG8gd29ybGQgdGhpcyBpcyB0ZXh0", ""},
+		{"short token", "k=1G2be3bbF94b", ""},
+		{"word", "supercalifragilisticexpialidocious", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			risks := ScanEntropy([]byte(test.data), DefaultEntropyConfig())
+			if test.found == "" {
+				if len(risks) != 0 {
+					t.Fatalf("expected no risk, got %q", risks[0].Value)
+				}
+				return
+			}
+			if len(risks) != 1 || risks[0].Value != test.found {
+				t.Fatalf("expected risk %q, got %v", test.found, risks)
+			}
+			if risks[0].Type != "high_entropy_string" || risks[0].Category != "SECRET" {
+				t.Fatalf("unexpected risk category and type %s %s", risks[0].Category, risks[0].Type)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	pb "github.com/BluBracket/database-risk-scanner/grpc/api"
+)
+
+// HashAudit audits how the values of a credential column are hashed.
+// it flags fast unsalted digests (md5, sha1, sha256, ...), md5-crypt, low bcrypt cost factors and plaintext,
+// and tracks duplicate values, which show missing salts.
+// it is safe for concurrent use.
+type HashAudit struct {
+	// MinBcryptCost is the minimum bcrypt cost factor which is not weak
+	MinBcryptCost int
+
+	mu         sync.Mutex
+	algorithms map[string]int
+	total      int
+	weak       int
+	// values holds the records per value fingerprint to find duplicates
+	values map[[sha256.Size]byte]*auditedValue
+}
+
+// auditedValue is a value and the records having it
+type auditedValue struct {
+	value   string
+	records []string
+}
+
+// maxDuplicateRecords is the max number of duplicate records listed in the tags of a risk
+const maxDuplicateRecords = 10
+
+// HashSummary is the summary of a HashAudit for a column
+type HashSummary struct {
+	// Total is the number of values audited
+	Total int
+	// Algorithms is the number of values per hash algorithm
+	Algorithms map[string]int
+	// Weak is the number of weak values
+	Weak int
+	// WeakPercent is the percentage of weak values
+	WeakPercent float64
+	// Duplicates is the number of values shared by more than one record
+	Duplicates int
+}
+
+// NewHashAudit returns a HashAudit flagging bcrypt hashes with cost below minBcryptCost
+func NewHashAudit(minBcryptCost int) *HashAudit {
+	return &HashAudit{
+		MinBcryptCost: minBcryptCost,
+		algorithms:    map[string]int{},
+		values:        map[[sha256.Size]byte]*auditedValue{},
+	}
+}
+
+// HashAlgorithm identifies the hash algorithm of a credential value.
+// password hashing schemes are reported as classified by ClassifyCredential, digests by their size or prefix,
+// e.g. md5, sha1, sha256, ssha.
+func HashAlgorithm(value string) string {
+	v := strings.TrimSpace(value)
+	class := ClassifyCredential(v)
+	if class != ClassDigest {
+		return class
+	}
+	if m := ldapDigest.FindStringSubmatch(v); m != nil {
+		return strings.ToLower(strings.Trim(m[0], "{}"))
+	}
+	size := len(v) / 2
+	if !hexDigest.MatchString(v) {
+		size = base64DigestSize(v)
+	}
+	switch size {
+	case 16:
+		return "md5"
+	case 20:
+		return "sha1"
+	case 32:
+		return "sha256"
+	case 48:
+		return "sha384"
+	case 64:
+		return "sha512"
+	}
+	return ClassDigest
+}
+
+// weakness returns why a value hashed with the algorithm is weak, or an empty string if it is not.
+func (a *HashAudit) weakness(algorithm, value string) string {
+	switch algorithm {
+	case ClassPlaintext:
+		return "not hashed"
+	case ClassMd5Crypt, "md5", "smd5":
+		return "md5 is broken"
+	case "sha1", "ssha", "sha":
+		return "sha1 is broken"
+	case "sha256", "sha384", "sha512", ClassDigest:
+		return "unsalted fast digest"
+	case "ssha256", "ssha384", "ssha512":
+		return "fast digest"
+	case ClassBcrypt:
+		cost, err := strconv.Atoi(strings.Split(strings.TrimSpace(value), "$")[2])
+		if err == nil && cost < a.MinBcryptCost {
+			return fmt.Sprintf("bcrypt cost %d is below %d", cost, a.MinBcryptCost)
+		}
+	}
+	return ""
+}
+
+// Add audits the value of a record. it returns a low severity risk if the value is weakly hashed.
+func (a *HashAudit) Add(recordId string, data []byte) (risks []*pb.Risk) {
+	value := strings.TrimSpace(string(data))
+	if value == "" {
+		return
+	}
+	algorithm := HashAlgorithm(value)
+	reason := a.weakness(algorithm, value)
+
+	a.mu.Lock()
+	a.total++
+	a.algorithms[algorithm]++
+	if reason != "" {
+		a.weak++
+	}
+	fp := sha256.Sum256([]byte(value))
+	v, ok := a.values[fp]
+	if !ok {
+		v = &auditedValue{value: value}
+		a.values[fp] = v
+	}
+	v.records = append(v.records, recordId)
+	a.mu.Unlock()
+
+	if reason == "" {
+		return
+	}
+	risks = append(risks, a.risk("weak_password_hash", value, data, map[string]string{
+		"algorithm": jsonString(algorithm),
+		"reason":    jsonString(reason),
+	}))
+	return
+}
+
+// Duplicates returns a low severity risk for each record sharing its value with other records,
+// keyed by record id. with salted hashes, equal passwords have different hashes, so duplicates
+// show missing salts. it should be called once all the values are added.
+func (a *HashAudit) Duplicates() (findings map[string][]*pb.Risk) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	findings = map[string][]*pb.Risk{}
+	for _, v := range a.values {
+		if len(v.records) < 2 {
+			continue
+		}
+		for _, id := range v.records {
+			var others []string
+			for _, o := range v.records {
+				if o != id && len(others) < maxDuplicateRecords {
+					others = append(others, o)
+				}
+			}
+			findings[id] = append(findings[id], a.risk("duplicate_password_hash", v.value, []byte(v.value), map[string]string{
+				"count":            strconv.Itoa(len(v.records)),
+				"duplicateRecords": jsonValue(others),
+			}))
+		}
+	}
+	return
+}
+
+// Summary returns the summary of the audit
+func (a *HashAudit) Summary() (s HashSummary) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s.Total = a.total
+	s.Weak = a.weak
+	s.Algorithms = map[string]int{}
+	for k, v := range a.algorithms {
+		s.Algorithms[k] = v
+	}
+	if a.total > 0 {
+		s.WeakPercent = math.Round(float64(a.weak)*10000/float64(a.total)) / 100
+	}
+	for _, v := range a.values {
+		if len(v.records) > 1 {
+			s.Duplicates++
+		}
+	}
+	return
+}
+
+// risk returns a low severity risk for the value
+func (a *HashAudit) risk(riskType, value string, data []byte, tags map[string]string) *pb.Risk {
+	start := strings.Index(string(data), value)
+	line1, col1 := lineCol(data, start)
+	line2, col2 := lineCol(data, start+len(value))
+	return &pb.Risk{
+		Category:       "SECRET",
+		Type:           riskType,
+		Severity:       "low",
+		Value:          value,
+		TextualContext: lineAt(data, start),
+		Line1:          line1,
+		Col1:           col1,
+		Line2:          line2,
+		Col2:           col2,
+		Tags:           tags,
+	}
+}
+
+// base64DigestSize returns the decoded size of a base64 encoded digest
+func base64DigestSize(v string) int {
+	if !base64Digest(v) {
+		return 0
+	}
+	return len(v)/4*3 - strings.Count(v, "=")
+}
@@ -0,0 +1,26 @@
+package engine
+
+import "testing"
+
+func TestHashAlgorithm(t *testing.T) {
+	tests := []struct {
+		value     string
+		algorithm string
+	}{
+		{"5f4dcc3b5aa765d61d8327deb882cf99", "md5"},
+		{"5baa61e4c9b93f3f0682250b6cf8331b7ee68fd8", "sha1"},
+		{"5E884898DA28047151D0E56F8DC6292773603D0D6AABBDD62A11EF721D1542D8", "sha256"},
+		{"X03MO1qnZdYdgyfeuILPmQ==", "md5"},
+		{"{SSHA}yI6cZwQadOA1e+/f+T+H3eCQQhRzYWx0", "ssha"},
+		{"{SHA256}XohImNooBHFR0OVvjcYpJ3NgPQ1qq73WKhHvch0VQtg=", "sha256"},
+		{"$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy", ClassBcrypt},
+		{"$1$saltsalt$qjXMvbEw8oGL.X5mO.mqj1", ClassMd5Crypt},
+		{"hunter2", ClassPlaintext},
+		{"5f4dcc3b5aa765d61d8327deb882cf9", ClassPlaintext},
+	}
+	for _, test := range tests {
+		if algorithm := HashAlgorithm(test.value); algorithm != test.algorithm {
+			t.Errorf("HashAlgorithm(%q): expected %s, got %s", test.value, test.algorithm, algorithm)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// rulesFile is the format of a rules file. for example:
+//
+//	rules:
+//	  - name: internal_api_token
+//	    regex: '\bitk_[0-9a-f]{32}\b'
+//	    keywords: [itk_]
+//	    min_entropy: 3
+//	    category: SECRET
+//	    type: internal_api_token
+//	    severity: high
+//	    column: '(?i)token|notes'
+type rulesFile struct {
+	Rules []ruleConfig `yaml:"rules"`
+}
+
+type ruleConfig struct {
+	Name       string   `yaml:"name"`
+	Regex      string   `yaml:"regex"`
+	Keywords   []string `yaml:"keywords"`
+	MinEntropy float64  `yaml:"min_entropy"`
+	Category   string   `yaml:"category"`
+	Type       string   `yaml:"type"`
+	Severity   string   `yaml:"severity"`
+	Column     string   `yaml:"column"`
+}
+
+// LoadRules reads rules from a yaml rules file.
+// name and regex are required for each rule. category defaults to SECRET, type to the rule name
+// and severity to medium.
+func LoadRules(path string) (rules Rules, err error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		err = errors.Wrap(err, "failed to read rules file")
+		return
+	}
+	var f rulesFile
+	err = yaml.Unmarshal(b, &f)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to parse rules file %s", path)
+		return
+	}
+	names := map[string]bool{}
+	for i, c := range f.Rules {
+		var r *Rule
+		r, err = c.rule()
+		if err != nil {
+			err = errors.Wrapf(err, "invalid rule #%d in %s", i+1, path)
+			return
+		}
+		if names[r.Name] {
+			err = errors.New(fmt.Sprintf("duplicate rule name %q in %s", r.Name, path))
+			return
+		}
+		names[r.Name] = true
+		rules = append(rules, r)
+	}
+	return
+}
+
+// rule validates the rule config and compiles it to a Rule
+func (c ruleConfig) rule() (r *Rule, err error) {
+	if c.Name == "" {
+		err = errors.New("name is required")
+		return
+	}
+	if c.Regex == "" {
+		err = errors.New(fmt.Sprintf("regex is required for rule %q", c.Name))
+		return
+	}
+	r = &Rule{
+		Name:       c.Name,
+		Category:   c.Category,
+		Type:       c.Type,
+		Severity:   strings.ToLower(c.Severity),
+		Keywords:   c.Keywords,
+		MinEntropy: c.MinEntropy,
+	}
+	if r.Category == "" {
+		r.Category = "SECRET"
+	}
+	if r.Type == "" {
+		r.Type = c.Name
+	}
+	if r.Severity == "" {
+		r.Severity = "medium"
+	}
+	if SeverityRank(r.Severity) < 0 {
+		err = errors.New(fmt.Sprintf("unsupported severity %q for rule %q. supported severities are (%s)",
+			c.Severity, c.Name, strings.Join(Severities, ", ")))
+		return
+	}
+	r.Pattern, err = regexp.Compile(c.Regex)
+	if err != nil {
+		err = errors.Wrapf(err, "invalid regex for rule %q", c.Name)
+		return
+	}
+	if c.Column != "" {
+		r.Column, err = regexp.Compile(c.Column)
+		if err != nil {
+			err = errors.Wrapf(err, "invalid column condition for rule %q", c.Name)
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,152 @@
+package engine
+
+import (
+	"encoding/base64"
+	"regexp"
+	"strings"
+
+	pb "github.com/BluBracket/database-risk-scanner/grpc/api"
+)
+
+// classifications of a value stored in a credential column
+const (
+	ClassBcrypt    = "bcrypt"
+	ClassArgon2    = "argon2"
+	ClassScrypt    = "scrypt"
+	ClassPbkdf2    = "pbkdf2"
+	ClassShaCrypt  = "sha_crypt"
+	ClassMd5Crypt  = "md5_crypt"
+	ClassDigest    = "digest"
+	ClassEncrypted = "encrypted"
+	ClassPlaintext = "plaintext"
+)
+
+var (
+	// credentialColumn matches the names of columns holding credentials, e.g. password, user_pwd, api_key
+	credentialColumn = regexp.MustCompile(`(?i)(^|[_\-.])(pass(word)?s?|passwd|passphrase|pwd|pin|secret|secret_?key|api_?key|apikey|access_?key|(auth_|access_|refresh_)?token|credentials?|private_?key|client_?secret)([_\-.]|$)`)
+	// credentialMetadataColumn matches the names of columns holding information about credentials,
+	// e.g. password_changed_at, token_expiry
+	credentialMetadataColumn = regexp.MustCompile(`(?i)[_\-.](at|on|date|time|ts|expires?|expiry|expiration|count|attempts|policy|length|len|type|id|algo|algorithm|version|required|enabled|flag|reset)$`)
+	// credentialComment matches the comments of columns holding credentials
+	credentialComment = regexp.MustCompile(`(?i)\b(password|passphrase|secret|api key|credential|token)s?\b`)
+
+	bcryptHash   = regexp.MustCompile(`^\$2[abxy]?\$\d{2}\$[./A-Za-z0-9]{53}$`)
+	argon2Hash   = regexp.MustCompile(`^\$argon2(id|i|d)\$`)
+	scryptHash   = regexp.MustCompile(`^(\$scrypt\$|\$7\$|scrypt:)`)
+	pbkdf2Hash   = regexp.MustCompile(`^(\$pbkdf2(-sha\d+)?\$|pbkdf2_sha\d+\$|pbkdf2:sha\d+:|\{PBKDF2[^}]*\})`)
+	shaCryptHash = regexp.MustCompile(`^\$[56]\$(rounds=\d+\$)?[./A-Za-z0-9]{1,16}\$[./A-Za-z0-9]{43,86}$`)
+	md5CryptHash = regexp.MustCompile(`^\$(1|apr1)\$[./A-Za-z0-9]{1,8}\$[./A-Za-z0-9]{22}$`)
+	// ldapDigest matches LDAP style digests like {SSHA}base64
+	ldapDigest = regexp.MustCompile(`(?i)^\{(s?sha(256|384|512)?|s?md5|crypt)\}`)
+	hexDigest  = regexp.MustCompile(`^(?i:[0-9a-f]{32}|[0-9a-f]{40}|[0-9a-f]{64}|[0-9a-f]{96}|[0-9a-f]{128})$`)
+	// encryptedPrefix matches markers of encrypted values
+	encryptedPrefix = regexp.MustCompile(`^(ENC\(|vault:v\d+:|-----BEGIN PGP MESSAGE-----|AQICAH|gAAAAA)`)
+)
+
+// digestSizes are the byte sizes of md5, sha1, sha256, sha384 and sha512 digests
+var digestSizes = []int{16, 20, 32, 48, 64}
+
+// IsCredentialColumn tells from the name and comment of a column if it holds credentials
+func IsCredentialColumn(name, comment string) bool {
+	if credentialColumn.MatchString(name) {
+		return !credentialMetadataColumn.MatchString(name)
+	}
+	return credentialComment.MatchString(comment)
+}
+
+// ClassifyCredential classifies the value of a credential column as a password hash
+// (bcrypt, argon2, scrypt, pbkdf2, sha_crypt, md5_crypt), a raw digest, an encrypted looking value or plaintext.
+func ClassifyCredential(value string) string {
+	v := strings.TrimSpace(value)
+	switch {
+	case bcryptHash.MatchString(v):
+		return ClassBcrypt
+	case argon2Hash.MatchString(v):
+		return ClassArgon2
+	case scryptHash.MatchString(v):
+		return ClassScrypt
+	case pbkdf2Hash.MatchString(v):
+		return ClassPbkdf2
+	case shaCryptHash.MatchString(v):
+		return ClassShaCrypt
+	case md5CryptHash.MatchString(v):
+		return ClassMd5Crypt
+	case ldapDigest.MatchString(v), hexDigest.MatchString(v), base64Digest(v):
+		return ClassDigest
+	case encryptedPrefix.MatchString(v), encryptedLooking(v):
+		return ClassEncrypted
+	}
+	return ClassPlaintext
+}
+
+// base64Digest tells if v is a base64 encoded digest
+func base64Digest(v string) bool {
+	b, err := base64.StdEncoding.DecodeString(v)
+	return err == nil && containsInt(digestSizes, len(b))
+}
+
+// encryptedLooking tells if v looks like base64 encoded ciphertext: long, random and not text when decoded
+func encryptedLooking(v string) bool {
+	if len(v) < 24 || Entropy(v) < 4.5 {
+		return false
+	}
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if b, err := enc.DecodeString(v); err == nil && !printable(b) {
+			return true
+		}
+	}
+	return false
+}
+
+// ScanPlaintextCredential checks the value of a column holding credentials.
+// the column is identified by its name and comment. it returns a critical risk if the value
+// is neither a password hash, a digest nor encrypted. the classification is added to the tags.
+func ScanPlaintextCredential(column, comment string, data []byte) (risks []*pb.Risk) {
+	if !IsCredentialColumn(column, comment) {
+		return
+	}
+	return scanPlaintext(data, "column", column)
+}
+
+// ScanKeyedCredential checks a value stored under a key, e.g. in a key/value table.
+// keys holding credentials are identified like column names, e.g. smtp_password, stripe_secret.
+// it returns a critical risk if the value is neither a password hash, a digest nor encrypted,
+// whatever its format. the key and classification are added to the tags.
+func ScanKeyedCredential(key string, data []byte) (risks []*pb.Risk) {
+	if !IsCredentialColumn(key, "") {
+		return
+	}
+	return scanPlaintext(data, "key", key)
+}
+
+// scanPlaintext returns a critical risk if the value is plaintext. the name of the column or key
+// holding the value is added to the tags.
+func scanPlaintext(data []byte, nameTag, name string) (risks []*pb.Risk) {
+	value := strings.TrimSpace(string(data))
+	if value == "" {
+		return
+	}
+	class := ClassifyCredential(value)
+	if class != ClassPlaintext {
+		return
+	}
+	start := strings.Index(string(data), value)
+	line1, col1 := lineCol(data, start)
+	line2, col2 := lineCol(data, start+len(value))
+	risks = append(risks, &pb.Risk{
+		Category:       "SECRET",
+		Type:           "plaintext_password",
+		Severity:       "critical",
+		Value:          value,
+		TextualContext: lineAt(data, start),
+		Line1:          line1,
+		Col1:           col1,
+		Line2:          line2,
+		Col2:           col2,
+		Tags: map[string]string{
+			nameTag:          jsonString(name),
+			"classification": jsonString(class),
+		},
+	})
+	return
+}
@@ -0,0 +1,54 @@
+package engine
+
+import "testing"
+
+func TestClassifyCredential(t *testing.T) {
+	tests := []struct {
+		value string
+		class string
+	}{
+		{"$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy", ClassBcrypt},
+		{"$2a$10$N9qo8uLOickgx2ZMRZoMye", ClassPlaintext},
+		{"$argon2id$v=19$m=65536,t=3,p=4$c2FsdHNhbHQ$aGFzaGhhc2g", ClassArgon2},
+		{"$scrypt$ln=16,r=8,p=1$c2FsdA$aGFzaA", ClassScrypt},
+		{"pbkdf2_sha256$260000$salt$aGFzaA==", ClassPbkdf2},
+		{"$6$saltsalt$PGeN936uYK8Bv1.3gbLmBAB/uZ0Ba29bqba4jAzKVjNo0Wki9wC7dxzUstJ2LSwt8B6DlwTTb/Xbxqr4g.vOY0", ClassShaCrypt},
+		{"$1$saltsalt$qjXMvbEw8oGL.X5mO.mqj1", ClassMd5Crypt},
+		{"5f4dcc3b5aa765d61d8327deb882cf99", ClassDigest},
+		{" 5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8 ", ClassDigest},
+		{"5f4dcc3b5aa765d61d8327deb882cf9", ClassPlaintext},
+		{"{SSHA}yI6cZwQadOA1e+/f+T+H3eCQQhRzYWx0", ClassDigest},
+		{"X03MO1qnZdYdgyfeuILPmQ==", ClassDigest},
+		{"ENC(c2VjcmV0IHZhbHVl)", ClassEncrypted},
+		{"vault:v1:8SDd3WHDOjf7mq69CyCqYjBXAiQQAVZRkFM13ok481zoCmHnSeDX9vyf7w==", ClassEncrypted},
+		{"hunter2", ClassPlaintext},
+		{"correct horse battery staple", ClassPlaintext},
+		{"", ClassPlaintext},
+	}
+	for _, test := range tests {
+		if class := ClassifyCredential(test.value); class != test.class {
+			t.Errorf("ClassifyCredential(%q): expected %s, got %s", test.value, test.class, class)
+		}
+	}
+}
+
+func TestIsCredentialColumn(t *testing.T) {
+	tests := []struct {
+		name, comment string
+		credential    bool
+	}{
+		{"password", "", true},
+		{"user_pwd", "", true},
+		{"stripe_api_key", "", true},
+		{"password_changed_at", "", false},
+		{"token_expiry", "", false},
+		{"passenger", "", false},
+		{"notes", "the api key of the account", true},
+		{"notes", "free text", false},
+	}
+	for _, test := range tests {
+		if IsCredentialColumn(test.name, test.comment) != test.credential {
+			t.Errorf("IsCredentialColumn(%s, %q): expected %v", test.name, test.comment, test.credential)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package engine
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	pb "github.com/BluBracket/database-risk-scanner/grpc/api"
+)
+
+// piiDetector finds candidates with a pattern and confirms them with a validator.
+// only the candidates passing the validation are reported.
+type piiDetector struct {
+	// validator names the check confirming the candidate. it is added to the risk tags.
+	validator string
+	riskType  string
+	severity  string
+	pattern   *regexp.Regexp
+	// validate checks the candidate. it returns the confidence score (0-1) of a valid candidate
+	// and extra tags to add to the risk. ok is false for an invalid candidate.
+	validate func(candidate string) (confidence float64, tags map[string]string, ok bool)
+}
+
+// piiDetectors are run in order. a candidate overlapping the one of an earlier detector is skipped,
+// e.g. an IBAN is not reported again as a payment card.
+var piiDetectors = []piiDetector{
+	{
+		validator: "mod97", riskType: "iban", severity: "medium",
+		pattern:  regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]){11,30}\b`),
+		validate: validateIban,
+	},
+	{
+		validator: "luhn", riskType: "payment_card", severity: "high",
+		pattern:  regexp.MustCompile(`\b\d(?:[ \-]?\d){12,18}\b`),
+		validate: validatePaymentCard,
+	},
+	{
+		validator: "us_itin_structure", riskType: "us_itin", severity: "high",
+		pattern:  regexp.MustCompile(`\b9\d{2}[- ](?:5\d|6[0-5]|7\d|8[0-8]|9[0-24-9])[- ]\d{4}\b`),
+		validate: validateItin,
+	},
+	{
+		validator: "us_ssn_structure", riskType: "us_ssn", severity: "high",
+		pattern:  regexp.MustCompile(`\b\d{3}[- ]\d{2}[- ]\d{4}\b`),
+		validate: validateSsn,
+	},
+	{
+		validator: "uk_nino_structure", riskType: "uk_nino", severity: "high",
+		pattern:  regexp.MustCompile(`\b[A-CEGHJ-PR-TW-Z][A-CEGHJ-NPR-TW-Z] ?\d{2} ?\d{2} ?\d{2} ?[A-D]\b`),
+		validate: validateNino,
+	},
+	{
+		validator: "luhn", riskType: "ca_sin", severity: "high",
+		pattern:  regexp.MustCompile(`\b[1-79]\d{2}[- ]\d{3}[- ]\d{3}\b`),
+		validate: validateSin,
+	},
+	{
+		validator: "es_dni_checksum", riskType: "es_dni", severity: "medium",
+		pattern:  regexp.MustCompile(`\b\d{8}-?[A-Z]\b`),
+		validate: validateDni,
+	},
+	{
+		validator: "e164", riskType: "phone_number", severity: "low",
+		pattern:  regexp.MustCompile(`(?:\+\d[\d ()\-.]{6,20}\d|\(?\b[2-9]\d{2}\)?[ .\-][2-9]\d{2}[ .\-]\d{4}\b)`),
+		validate: validatePhone,
+	},
+}
+
+// ScanPII finds personally identifiable information in data, confirming each candidate with a validator:
+// Luhn and BIN ranges for payment cards, mod-97 for IBAN, structural rules for national ids and
+// E.164 normalisation for phone numbers.
+// risks have category PII. 'validator' and 'confidence' tags tell which check confirmed the risk and how sure it is.
+func ScanPII(data []byte) (risks []*pb.Risk) {
+	var taken [][2]int
+	overlaps := func(start, end int) bool {
+		for _, t := range taken {
+			if start < t[1] && t[0] < end {
+				return true
+			}
+		}
+		return false
+	}
+	for _, d := range piiDetectors {
+		for _, m := range d.pattern.FindAllIndex(data, -1) {
+			start, end := m[0], m[1]
+			if overlaps(start, end) {
+				continue
+			}
+			value := string(data[start:end])
+			confidence, tags, ok := d.validate(value)
+			if !ok {
+				continue
+			}
+			taken = append(taken, [2]int{start, end})
+			line1, col1 := lineCol(data, start)
+			line2, col2 := lineCol(data, end)
+			risk := &pb.Risk{
+				Category:       "PII",
+				Type:           d.riskType,
+				Severity:       d.severity,
+				Value:          value,
+				TextualContext: lineAt(data, start),
+				Line1:          line1,
+				Col1:           col1,
+				Line2:          line2,
+				Col2:           col2,
+				Tags: map[string]string{
+					"validator":  jsonString(d.validator),
+					"confidence": strconv.FormatFloat(confidence, 'f', 2, 64),
+				},
+			}
+			for k, v := range tags {
+				risk.Tags[k] = v
+			}
+			risks = append(risks, risk)
+		}
+	}
+	sort.SliceStable(risks, func(i, j int) bool {
+		if risks[i].Line1 != risks[j].Line1 {
+			return risks[i].Line1 < risks[j].Line1
+		}
+		return risks[i].Col1 < risks[j].Col1
+	})
+	return
+}
+
+// digits returns the digits of s
+func digits(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if c >= '0' && c <= '9' {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// luhn checks the Luhn checksum of a digit string
+func luhn(number string) bool {
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		d := int(number[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// cardBrand is a payment card brand identified by BIN (leading digits) ranges and number lengths
+type cardBrand struct {
+	name    string
+	ranges  [][2]int // inclusive ranges of the prefix
+	prefix  int      // number of leading digits the ranges apply to
+	lengths []int
+}
+
+var cardBrands = []cardBrand{
+	{name: "amex", prefix: 2, ranges: [][2]int{{34, 34}, {37, 37}}, lengths: []int{15}},
+	{name: "visa", prefix: 1, ranges: [][2]int{{4, 4}}, lengths: []int{13, 16, 19}},
+	{name: "mastercard", prefix: 4, ranges: [][2]int{{5100, 5599}, {2221, 2720}}, lengths: []int{16}},
+	{name: "discover", prefix: 4, ranges: [][2]int{{6011, 6011}, {6440, 6599}}, lengths: []int{16, 17, 18, 19}},
+	{name: "jcb", prefix: 4, ranges: [][2]int{{3528, 3589}}, lengths: []int{16, 17, 18, 19}},
+	{name: "diners", prefix: 3, ranges: [][2]int{{300, 305}, {360, 369}, {380, 399}}, lengths: []int{14, 15, 16, 17, 18, 19}},
+	{name: "unionpay", prefix: 2, ranges: [][2]int{{62, 62}}, lengths: []int{16, 17, 18, 19}},
+	{name: "maestro", prefix: 2, ranges: [][2]int{{50, 50}, {56, 58}, {67, 67}}, lengths: []int{12, 13, 14, 15, 16, 17, 18, 19}},
+}
+
+// brandOf returns the brand of the card number, if any
+func brandOf(number string) string {
+	for _, b := range cardBrands {
+		if len(number) < b.prefix || !containsInt(b.lengths, len(number)) {
+			continue
+		}
+		p, _ := strconv.Atoi(number[:b.prefix])
+		for _, r := range b.ranges {
+			if p >= r[0] && p <= r[1] {
+				return b.name
+			}
+		}
+	}
+	return ""
+}
+
+func validatePaymentCard(candidate string) (confidence float64, tags map[string]string, ok bool) {
+	number := digits(candidate)
+	if strings.Count(number, number[:1]) == len(number) || !luhn(number) {
+		return
+	}
+	brand := brandOf(number)
+	if brand == "" {
+		// luhn alone passes one in ten random numbers, e.g. order numbers
+		return
+	}
+	confidence = 0.9
+	if strings.ContainsAny(candidate, " -") {
+		// grouped as printed on a card
+		confidence = 0.95
+	}
+	return confidence, map[string]string{"brand": jsonString(brand)}, true
+}
+
+// ibanLengths are the IBAN lengths per country code
+var ibanLengths = map[string]int{
+	"AD": 24, "AE": 23, "AL": 28, "AT": 20, "AZ": 28, "BA": 20, "BE": 16, "BG": 22, "BH": 22, "BR": 29,
+	"BY": 28, "CH": 21, "CR": 22, "CY": 28, "CZ": 24, "DE": 22, "DK": 18, "DO": 28, "EE": 20, "EG": 29,
+	"ES": 24, "FI": 18, "FO": 18, "FR": 27, "GB": 22, "GE": 22, "GI": 23, "GL": 18, "GR": 27, "GT": 28,
+	"HR": 21, "HU": 28, "IE": 22, "IL": 23, "IQ": 23, "IS": 26, "IT": 27, "JO": 30, "KW": 30, "KZ": 20,
+	"LB": 28, "LC": 32, "LI": 21, "LT": 20, "LU": 20, "LV": 21, "MC": 27, "MD": 24, "ME": 22, "MK": 19,
+	"MR": 27, "MT": 31, "MU": 30, "NL": 18, "NO": 15, "PK": 24, "PL": 28, "PS": 29, "PT": 25, "QA": 29,
+	"RO": 24, "RS": 22, "SA": 24, "SC": 31, "SE": 24, "SI": 19, "SK": 24, "SM": 27, "ST": 25, "SV": 28,
+	"TL": 23, "TN": 24, "TR": 26, "UA": 29, "VA": 22, "VG": 24, "XK": 20,
+}
+
+func validateIban(candidate string) (confidence float64, tags map[string]string, ok bool) {
+	iban := strings.ReplaceAll(candidate, " ", "")
+	if ibanLengths[iban[:2]] != len(iban) {
+		return
+	}
+	// move country code and check digits to the end, convert letters to numbers and compute mod 97
+	rearranged := iban[4:] + iban[:4]
+	mod := 0
+	for _, c := range rearranged {
+		var v int
+		switch {
+		case c >= '0' && c <= '9':
+			v = int(c - '0')
+			mod = (mod*10 + v) % 97
+		case c >= 'A' && c <= 'Z':
+			v = int(c-'A') + 10
+			mod = (mod*100 + v) % 97
+		default:
+			return
+		}
+	}
+	if mod != 1 {
+		return
+	}
+	return 0.95, map[string]string{"country": jsonString(iban[:2])}, true
+}
+
+func validateSsn(candidate string) (confidence float64, tags map[string]string, ok bool) {
+	n := digits(candidate)
+	area, group, serial := n[:3], n[3:5], n[5:]
+	if area == "000" || area == "666" || area[0] == '9' || group == "00" || serial == "0000" {
+		return
+	}
+	// numbers used in advertisements and documentation
+	if n == "078051120" || n == "219099999" {
+		return
+	}
+	if !sameSeparators(candidate, 3, 6) {
+		return
+	}
+	return 0.8, nil, true
+}
+
+func validateItin(candidate string) (confidence float64, tags map[string]string, ok bool) {
+	if !sameSeparators(candidate, 3, 6) {
+		return
+	}
+	return 0.85, nil, true
+}
+
+// sameSeparators tells if the separators of the candidate at the offsets are the same, e.g. not '900-70 1234'
+func sameSeparators(candidate string, offsets ...int) bool {
+	for _, o := range offsets[1:] {
+		if candidate[o] != candidate[offsets[0]] {
+			return false
+		}
+	}
+	return true
+}
+
+// ninoInvalidPrefixes are UK national insurance number prefixes which are not allocated
+var ninoInvalidPrefixes = []string{"BG", "GB", "NK", "KN", "TN", "NT", "ZZ"}
+
+func validateNino(candidate string) (confidence float64, tags map[string]string, ok bool) {
+	nino := strings.ReplaceAll(candidate, " ", "")
+	for _, p := range ninoInvalidPrefixes {
+		if strings.HasPrefix(nino, p) {
+			return
+		}
+	}
+	return 0.85, nil, true
+}
+
+func validateSin(candidate string) (confidence float64, tags map[string]string, ok bool) {
+	if !sameSeparators(candidate, 3, 7) || !luhn(digits(candidate)) {
+		return
+	}
+	return 0.75, nil, true
+}
+
+// dniLetters are the check letters of Spanish DNI numbers indexed by number mod 23
+const dniLetters = "TRWAGMYFPDXBNJZSQVHLCKE"
+
+func validateDni(candidate string) (confidence float64, tags map[string]string, ok bool) {
+	n, err := strconv.Atoi(candidate[:8])
+	if err != nil || dniLetters[n%23] != candidate[len(candidate)-1] {
+		return
+	}
+	return 0.8, nil, true
+}
+
+// validatePhone normalises the candidate to E.164. numbers without country code are assumed to be
+// north american (+1) numbers.
+func validatePhone(candidate string) (confidence float64, tags map[string]string, ok bool) {
+	n := digits(candidate)
+	confidence = 0.6
+	if !strings.HasPrefix(candidate, "+") {
+		if len(n) != 10 {
+			return
+		}
+		n = "1" + n
+		confidence = 0.5
+	}
+	// E.164 numbers have at most 15 digits and the country code does not start with 0
+	if len(n) < 8 || len(n) > 15 || n[0] == '0' {
+		return
+	}
+	return confidence, map[string]string{"e164": jsonString("+" + n)}, true
+}
+
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package engine
+
+import "testing"
+
+func TestLuhn(t *testing.T) {
+	tests := []struct {
+		number string
+		valid  bool
+	}{
+		{"4111111111111111", true},
+		{"79927398713", true},
+		{"0", true},
+		{"4111111111111112", false},
+		{"79927398710", false},
+	}
+	for _, test := range tests {
+		if luhn(test.number) != test.valid {
+			t.Errorf("luhn(%s): expected %v", test.number, test.valid)
+		}
+	}
+}
+
+func TestValidateIban(t *testing.T) {
+	tests := []struct {
+		candidate string
+		valid     bool
+		country   string
+	}{
+		{"GB82WEST12345698765432", true, `"GB"`},
+		{"DE89 3704 0044 0532 0130 00", true, `"DE"`},
+		{"NO9386011117947", true, `"NO"`},
+		{"GB82WEST12345698765431", false, ""},
+		{"GB82WEST1234569876543", false, ""},
+		{"XX82WEST12345698765432", false, ""},
+		{"DE89 3704 0044 0532 0130 0!", false, ""},
+	}
+	for _, test := range tests {
+		_, tags, ok := validateIban(test.candidate)
+		if ok != test.valid {
+			t.Errorf("validateIban(%s): expected %v", test.candidate, test.valid)
+		}
+		if ok && tags["country"] != test.country {
+			t.Errorf("validateIban(%s): expected country %s, got %s", test.candidate, test.country, tags["country"])
+		}
+	}
+}
+
+func TestScanPIINationalIds(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		riskType string
+	}{
+		{"ssn", "ssn 123-45-6789", "us_ssn"},
+		{"ssn with spaces", "ssn 123 45 6789", "us_ssn"},
+		{"ssn with mixed separators", "ssn 123-45 6789", ""},
+		{"ssn of advertisements", "ssn 078-05-1120", ""},
+		{"ssn with zero group", "ssn 123-00-6789", ""},
+		{"itin", "itin 912-78-1234", "us_itin"},
+		{"itin with spaces", "itin 912 88 1234", "us_itin"},
+		{"itin with mixed separators", "itin 912-88 1234", ""},
+		{"itin with invalid group", "itin 912-89-1234", ""},
+		{"sin", "sin 130-692-544", "ca_sin"},
+		{"sin with mixed separators", "sin 130-692 544", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			risks := ScanPII([]byte(test.data))
+			if test.riskType == "" {
+				if len(risks) != 0 {
+					t.Fatalf("expected no risk, got %s %q", risks[0].Type, risks[0].Value)
+				}
+				return
+			}
+			if len(risks) != 1 || risks[0].Type != test.riskType {
+				t.Fatalf("expected a %s risk, got %v", test.riskType, risks)
+			}
+		})
+	}
+}
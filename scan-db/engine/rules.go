@@ -0,0 +1,276 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"regexp"
+	"strings"
+
+	pb "github.com/BluBracket/database-risk-scanner/grpc/api"
+)
+
+// Rule detects a risk in text with a regular expression.
+// the risk value is the first non-empty capturing group of the pattern, or the whole match if it has no groups.
+type Rule struct {
+	// Name identifies the rule. it is added to the risk tags as 'rule'.
+	Name string
+	// Category, Type and Severity are set on the risk found by the rule
+	Category string
+	Type     string
+	Severity string
+	// Pattern matches the risk
+	Pattern *regexp.Regexp
+	// Keywords, if any, must appear in the text (case-insensitive) for the rule to run.
+	// they are used to skip the pattern for text which can not match.
+	Keywords []string
+	// MinEntropy is the minimum Shannon entropy (bits per char) of the value. zero disables the check.
+	MinEntropy float64
+	// Column, if set, restricts the rule to data read from the columns with matching name
+	Column *regexp.Regexp
+}
+
+// Severities are the supported risk severities in increasing order
+var Severities = []string{"info", "low", "medium", "high", "critical"}
+
+// SeverityRank returns the rank of the severity in Severities, or -1 if it is not supported.
+// severity is case-insensitive.
+func SeverityRank(severity string) int {
+	s := strings.ToLower(severity)
+	for i, v := range Severities {
+		if s == v {
+			return i
+		}
+	}
+	return -1
+}
+
+// Rules is a set of rules
+type Rules []*Rule
+
+// DefaultRules returns the built-in rule set for common secrets.
+func DefaultRules() Rules {
+	return Rules{
+		{
+			Name: "aws_access_key_id", Category: "SECRET", Type: "aws_access_key_id", Severity: "critical",
+			Pattern:  regexp.MustCompile(`\b((?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[0-9A-Z]{16})\b`),
+			Keywords: []string{"akia", "asia", "agpa", "aida", "aroa", "anpa", "anva", "aipa"},
+		},
+		{
+			Name: "aws_secret_access_key", Category: "SECRET", Type: "aws_secret_access_key", Severity: "critical",
+			Pattern:    regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key["']?\s*[=:]\s*["']?([A-Za-z0-9/+=]{40})\b`),
+			Keywords:   []string{"secret"},
+			MinEntropy: 3.5,
+		},
+		{
+			Name: "gcp_api_key", Category: "SECRET", Type: "gcp_api_key", Severity: "high",
+			Pattern:  regexp.MustCompile(`\b(AIza[0-9A-Za-z_\-]{35})\b`),
+			Keywords: []string{"aiza"},
+		},
+		{
+			Name: "private_key", Category: "SECRET", Type: "private_key", Severity: "critical",
+			Pattern:  regexp.MustCompile(`-----BEGIN (?:RSA |EC |DSA |OPENSSH |ENCRYPTED |PGP )?PRIVATE KEY(?: BLOCK)?-----[\s\S]*?-----END (?:RSA |EC |DSA |OPENSSH |ENCRYPTED |PGP )?PRIVATE KEY(?: BLOCK)?-----`),
+			Keywords: []string{"private key"},
+		},
+		{
+			Name: "certificate", Category: "SECRET", Type: "certificate", Severity: "info",
+			Pattern:  regexp.MustCompile(`-----BEGIN CERTIFICATE-----[\s\S]*?-----END CERTIFICATE-----`),
+			Keywords: []string{"begin certificate"},
+		},
+		{
+			Name: "github_token", Category: "SECRET", Type: "github_token", Severity: "critical",
+			Pattern:  regexp.MustCompile(`\b((?:ghp|gho|ghu|ghs|ghr)_[0-9A-Za-z]{36}|github_pat_[0-9A-Za-z_]{82})\b`),
+			Keywords: []string{"ghp_", "gho_", "ghu_", "ghs_", "ghr_", "github_pat_"},
+		},
+		{
+			Name: "gitlab_token", Category: "SECRET", Type: "gitlab_token", Severity: "critical",
+			Pattern:  regexp.MustCompile(`\b(glpat-[0-9A-Za-z_\-]{20})\b`),
+			Keywords: []string{"glpat-"},
+		},
+		{
+			Name: "slack_token", Category: "SECRET", Type: "slack_token", Severity: "high",
+			Pattern:  regexp.MustCompile(`\b(xox[abposr]-[0-9A-Za-z\-]{10,72})\b`),
+			Keywords: []string{"xox"},
+		},
+		{
+			Name: "slack_webhook", Category: "SECRET", Type: "slack_webhook", Severity: "high",
+			Pattern:  regexp.MustCompile(`(https://hooks\.slack\.com/services/T[0-9A-Za-z_]+/B[0-9A-Za-z_]+/[0-9A-Za-z_]+)`),
+			Keywords: []string{"hooks.slack.com"},
+		},
+		{
+			Name: "stripe_secret_key", Category: "SECRET", Type: "stripe_secret_key", Severity: "critical",
+			Pattern:  regexp.MustCompile(`\b((?:sk|rk)_live_[0-9A-Za-z]{24,99})\b`),
+			Keywords: []string{"_live_"},
+		},
+		{
+			Name: "sendgrid_api_key", Category: "SECRET", Type: "sendgrid_api_key", Severity: "high",
+			Pattern:  regexp.MustCompile(`\b(SG\.[0-9A-Za-z_\-]{22}\.[0-9A-Za-z_\-]{43})\b`),
+			Keywords: []string{"sg."},
+		},
+		{
+			Name: "twilio_api_key", Category: "SECRET", Type: "twilio_api_key", Severity: "high",
+			Pattern:  regexp.MustCompile(`\b(SK[0-9a-fA-F]{32})\b`),
+			Keywords: []string{"sk"},
+		},
+		{
+			Name: "azure_storage_key", Category: "SECRET", Type: "azure_storage_key", Severity: "critical",
+			Pattern:  regexp.MustCompile(`(?i)AccountKey=([A-Za-z0-9/+]{86}==)`),
+			Keywords: []string{"accountkey"},
+		},
+		{
+			Name: "jwt", Category: "SECRET", Type: "jwt", Severity: "medium",
+			Pattern:  regexp.MustCompile(`\b(eyJ[0-9A-Za-z_\-]{8,}\.eyJ[0-9A-Za-z_\-]{8,}\.[0-9A-Za-z_\-]*)`),
+			Keywords: []string{"eyj"},
+		},
+		{
+			Name: "password_in_url", Category: "SECRET", Type: "password_in_url", Severity: "high",
+			Pattern:  regexp.MustCompile(`(?i)\b[a-z][a-z0-9+.\-]*://[^:/@\s'"]+:([^@\s'"]+)@`),
+			Keywords: []string{"://"},
+		},
+		{
+			Name: "password_assignment", Category: "SECRET", Type: "password_assignment", Severity: "high",
+			Pattern:  regexp.MustCompile(`(?i)\b(?:password|passwd|pwd|secret)["']?\s*[=:]\s*(?:'([^']+)'|"([^"]+)"|([^\s;,'"})]+))`),
+			Keywords: []string{"pass", "pwd", "secret"},
+		},
+		{
+			Name: "token_assignment", Category: "SECRET", Type: "token_assignment", Severity: "high",
+			Pattern:    regexp.MustCompile(`(?i)\b(?:api_?key|apikey|access_?token|auth_?token|secret_?key|client_?secret)["']?\s*[=:]\s*["']?([0-9A-Za-z_\-+/=.]{16,})`),
+			Keywords:   []string{"key", "token", "secret"},
+			MinEntropy: 3,
+		},
+	}
+}
+
+// Select returns the rules with the given names
+func (rules Rules) Select(names ...string) (selected Rules) {
+	for _, r := range rules {
+		for _, name := range names {
+			if r.Name == name {
+				selected = append(selected, r)
+				break
+			}
+		}
+	}
+	return
+}
+
+// ForColumn returns the rules which apply to data read from the column.
+// rules without column condition apply to all columns.
+func (rules Rules) ForColumn(column string) (selected Rules) {
+	for _, r := range rules {
+		if r.Column == nil || r.Column.MatchString(column) {
+			selected = append(selected, r)
+		}
+	}
+	return
+}
+
+// Scan runs all the rules on data and returns the risks found.
+// line and column numbers of the risks are relative to data.
+func (rules Rules) Scan(data []byte) (risks []*pb.Risk) {
+	lower := bytes.ToLower(data)
+	for _, r := range rules {
+		risks = append(risks, r.Scan(data, lower)...)
+	}
+	return
+}
+
+// Scan runs the rule on data and returns the risks found.
+// lower is data in lower case, used to look for the keywords.
+func (r *Rule) Scan(data, lower []byte) (risks []*pb.Risk) {
+	if !r.hasKeyword(lower) {
+		return
+	}
+	for _, m := range r.Pattern.FindAllSubmatchIndex(data, -1) {
+		start, end := valueIndex(m)
+		value := string(data[start:end])
+		if r.MinEntropy > 0 && Entropy(value) < r.MinEntropy {
+			continue
+		}
+		line1, col1 := lineCol(data, start)
+		line2, col2 := lineCol(data, end)
+		risks = append(risks, &pb.Risk{
+			Category:       r.Category,
+			Type:           r.Type,
+			Severity:       r.Severity,
+			Value:          value,
+			TextualContext: lineAt(data, start),
+			Line1:          line1,
+			Col1:           col1,
+			Line2:          line2,
+			Col2:           col2,
+			Tags:           map[string]string{"rule": jsonString(r.Name)},
+		})
+	}
+	return
+}
+
+func (r *Rule) hasKeyword(lower []byte) bool {
+	if len(r.Keywords) == 0 {
+		return true
+	}
+	for _, k := range r.Keywords {
+		if bytes.Contains(lower, []byte(strings.ToLower(k))) {
+			return true
+		}
+	}
+	return false
+}
+
+// valueIndex returns the start and end of the first non-empty capturing group of the match,
+// or of the whole match if there is none.
+func valueIndex(m []int) (start, end int) {
+	for i := 2; i+1 < len(m); i += 2 {
+		if m[i] >= 0 && m[i+1] > m[i] {
+			return m[i], m[i+1]
+		}
+	}
+	return m[0], m[1]
+}
+
+// Entropy returns the Shannon entropy of s in bits per char
+func Entropy(s string) (e float64) {
+	if s == "" {
+		return
+	}
+	freq := map[rune]float64{}
+	n := 0.0
+	for _, c := range s {
+		freq[c]++
+		n++
+	}
+	for _, f := range freq {
+		p := f / n
+		e -= p * math.Log2(p)
+	}
+	return
+}
+
+// lineCol returns one-based line and column numbers of the offset in data
+func lineCol(data []byte, offset int) (line, col int32) {
+	before := data[:offset]
+	line = int32(bytes.Count(before, []byte("\n")) + 1)
+	col = int32(offset - bytes.LastIndexByte(before, '\n'))
+	return
+}
+
+// lineAt returns the line of data containing the offset
+func lineAt(data []byte, offset int) string {
+	start := bytes.LastIndexByte(data[:offset], '\n') + 1
+	end := bytes.IndexByte(data[offset:], '\n')
+	if end < 0 {
+		return string(data[start:])
+	}
+	return string(data[start : offset+end])
+}
+
+// jsonString json-encodes a tag value
+func jsonString(s string) string {
+	return jsonValue(s)
+}
+
+// jsonValue json-encodes a tag value of any type
+func jsonValue(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
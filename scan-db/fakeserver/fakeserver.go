@@ -0,0 +1,230 @@
+// Package fakeserver is a scripted in-process BluBracket gRPC server for tests and integrations.
+// it implements pb.BluBracketServer without the blubracket CLI: the risks it returns, and the failures it injects,
+// are given as rules matching the data of the streams. e.g.
+//
+//	s := fakeserver.New(
+//		fakeserver.Rule{Contains: "password=", Risks: []*pb.Risk{{Category: "SECRET", Type: "password_assignment"}}},
+//		fakeserver.Rule{Contains: "slow", Delay: time.Second},
+//		fakeserver.Rule{Contains: "boom", Reset: true, Times: 1},
+//	)
+//	conn, err := s.Dial()
+//	...
+//	defer s.Stop()
+//	d, err := detect.NewStream(ctx, pb.NewBluBracketClient(conn), handler)
+package fakeserver
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/BluBracket/database-risk-scanner/grpc/api"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// bufSize is the buffer size of the in-memory connection
+const bufSize = 1024 * 1024
+
+// Rule scripts the response to the streams it matches.
+// a stream is a metadata msg followed by data msgs, i.e. a record. it is matched once all its data is received.
+type Rule struct {
+	// StreamName matches the stream name of the stream metadata. empty matches any stream name.
+	StreamName string
+	// Contains matches the streams whose data contains it. empty matches any data.
+	Contains string
+	// Times is the number of streams the rule applies to. 0 applies it to all the matching streams.
+	Times int
+
+	// Delay is waited before responding
+	Delay time.Duration
+	// Risks are sent back with the metadata of the stream
+	Risks []*pb.Risk
+	// NilMetadata sends the risks without metadata, a malformed response
+	NilMetadata bool
+	// Context replaces the context of the metadata sent back with the risks, e.g. to answer an unknown record
+	Context string
+	// Err fails the AnalyzeStream call with the error, e.g. a status error
+	Err error
+	// Reset closes the connections of the server, as if the server died. the AnalyzeStream call is aborted.
+	Reset bool
+}
+
+// Stream is a stream received by the server
+type Stream struct {
+	Metadata *pb.AnalyzeStreamMetadata
+	Data     []byte
+}
+
+// Server is a BluBracket gRPC server answering the streams with the rules.
+// the first matching rule with remaining applications is applied to a stream. a stream matching no rule has no risk.
+type Server struct {
+	pb.UnimplementedBluBracketServer
+
+	mu       sync.Mutex
+	rules    []Rule
+	applied  []int
+	received []Stream
+	conns    []net.Conn
+
+	server   *grpc.Server
+	listener *bufconn.Listener
+}
+
+// New returns a Server scripted with the rules
+func New(rules ...Rule) *Server {
+	s := &Server{rules: rules, applied: make([]int, len(rules))}
+	s.server = grpc.NewServer()
+	pb.RegisterBluBracketServer(s.server, s)
+	return s
+}
+
+// Dial serves on an in-memory connection and establishes a connection to the server.
+// the connection reconnects after a Reset.
+func (s *Server) Dial() (conn *grpc.ClientConn, err error) {
+	s.listener = bufconn.Listen(bufSize)
+	go s.Serve(s.listener)
+	conn, err = grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return s.listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		err = errors.Wrap(err, "failed to connect to fake server")
+	}
+	return
+}
+
+// Serve serves on the listener, e.g. a unix socket given to scan-db with '--server'. it returns when the server is stopped.
+func (s *Server) Serve(l net.Listener) error {
+	return s.server.Serve(&trackingListener{Listener: l, s: s})
+}
+
+// Stop stops the server
+func (s *Server) Stop() {
+	s.server.Stop()
+}
+
+// Received returns the streams received so far, in the order they were received
+func (s *Server) Received() []Stream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Stream(nil), s.received...)
+}
+
+// AnalyzeStream receives the streams of the request stream and answers each with the rules
+func (s *Server) AnalyzeStream(stream pb.BluBracket_AnalyzeStreamServer) (err error) {
+	var metadata *pb.AnalyzeStreamMetadata
+	var data []byte
+	for {
+		var req *pb.AnalyzeStreamRequest
+		req, err = stream.Recv()
+		if err == io.EOF {
+			return s.answer(stream, metadata, data)
+		}
+		if err != nil {
+			return
+		}
+		if req.Metadata != nil {
+			err = s.answer(stream, metadata, data)
+			if err != nil {
+				return
+			}
+			metadata, data = req.Metadata, nil
+		}
+		data = append(data, req.Data...)
+	}
+}
+
+// answer records the stream and applies the matching rule to it
+func (s *Server) answer(stream pb.BluBracket_AnalyzeStreamServer, metadata *pb.AnalyzeStreamMetadata, data []byte) (err error) {
+	if metadata == nil {
+		return
+	}
+	rule, ok := s.match(metadata, data)
+	if !ok {
+		return
+	}
+	if rule.Delay > 0 {
+		select {
+		case <-time.After(rule.Delay):
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+	if rule.Err != nil {
+		return rule.Err
+	}
+	if rule.Reset {
+		s.reset()
+		return errors.New("connection reset")
+	}
+	responseMetadata := metadata
+	if rule.Context != "" {
+		responseMetadata = &pb.AnalyzeStreamMetadata{StreamName: metadata.StreamName, Context: rule.Context}
+	}
+	if rule.NilMetadata {
+		responseMetadata = nil
+	}
+	for _, risk := range rule.Risks {
+		err = stream.Send(&pb.AnalyzeStreamResponse{Risk: risk, Metadata: responseMetadata})
+		if err != nil {
+			err = errors.Wrap(err, "failed to send risk")
+			return
+		}
+	}
+	return
+}
+
+// match records the stream and returns the first matching rule with remaining applications
+func (s *Server) match(metadata *pb.AnalyzeStreamMetadata, data []byte) (rule Rule, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.received = append(s.received, Stream{Metadata: metadata, Data: data})
+	for i, r := range s.rules {
+		if r.StreamName != "" && r.StreamName != metadata.StreamName {
+			continue
+		}
+		if !strings.Contains(string(data), r.Contains) {
+			continue
+		}
+		if r.Times > 0 && s.applied[i] >= r.Times {
+			continue
+		}
+		s.applied[i]++
+		return r, true
+	}
+	return
+}
+
+// reset closes the connections accepted so far
+func (s *Server) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+	s.conns = nil
+}
+
+// trackingListener keeps the connections it accepts, so they can be reset
+type trackingListener struct {
+	net.Listener
+	s *Server
+}
+
+func (l *trackingListener) Accept() (c net.Conn, err error) {
+	c, err = l.Listener.Accept()
+	if err != nil {
+		return
+	}
+	l.s.mu.Lock()
+	defer l.s.mu.Unlock()
+	l.s.conns = append(l.s.conns, c)
+	return
+}
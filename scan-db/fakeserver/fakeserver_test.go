@@ -0,0 +1,125 @@
+package fakeserver_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	pb "github.com/BluBracket/database-risk-scanner/grpc/api"
+	"github.com/BluBracket/database-risk-scanner/scan-db/fakeserver"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var risk = &pb.Risk{Category: "SECRET", Type: "password_assignment"}
+
+// analyze sends the records, given as stream name and data, on a stream to the server
+// and returns the responses received till the stream ends
+func analyze(t *testing.T, s *fakeserver.Server, records ...[2]string) (responses []*pb.AnalyzeStreamResponse, err error) {
+	t.Helper()
+	conn, err := s.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	stream, err := pb.NewBluBracketClient(conn).AnalyzeStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range records {
+		metadata := &pb.AnalyzeStreamMetadata{StreamName: r[0], Context: string(rune('1' + i))}
+		if err = stream.Send(&pb.AnalyzeStreamRequest{Metadata: metadata}); err != nil {
+			break
+		}
+		if err = stream.Send(&pb.AnalyzeStreamRequest{Data: []byte(r[1])}); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = stream.CloseSend()
+	}
+	for err == nil {
+		var response *pb.AnalyzeStreamResponse
+		response, err = stream.Recv()
+		if err == nil {
+			responses = append(responses, response)
+		}
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	return
+}
+
+func TestRisksOfMatchingStreams(t *testing.T) {
+	s := fakeserver.New(fakeserver.Rule{StreamName: "notes", Contains: "password=", Risks: []*pb.Risk{risk}})
+	defer s.Stop()
+	responses, err := analyze(t, s, [2]string{"notes", "password=x"}, [2]string{"notes", "clean"}, [2]string{"info", "password=y"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != 1 || responses[0].Metadata.Context != "1" || responses[0].Metadata.StreamName != "notes" {
+		t.Fatalf("expected a risk for record 1, got %v", responses)
+	}
+	if received := s.Received(); len(received) != 3 || string(received[2].Data) != "password=y" {
+		t.Fatalf("expected the 3 streams to be received, got %v", received)
+	}
+}
+
+func TestRuleAppliedTimes(t *testing.T) {
+	s := fakeserver.New(fakeserver.Rule{Times: 1, Risks: []*pb.Risk{risk}})
+	defer s.Stop()
+	responses, err := analyze(t, s, [2]string{"notes", "a"}, [2]string{"notes", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != 1 || responses[0].Metadata.Context != "1" {
+		t.Fatalf("expected a risk for the first record only, got %v", responses)
+	}
+}
+
+func TestMalformedResponses(t *testing.T) {
+	s := fakeserver.New(
+		fakeserver.Rule{Contains: "nil", NilMetadata: true, Risks: []*pb.Risk{risk}},
+		fakeserver.Rule{Contains: "ghost", Context: "42", Risks: []*pb.Risk{risk}},
+	)
+	defer s.Stop()
+	responses, err := analyze(t, s, [2]string{"notes", "nil"}, [2]string{"notes", "ghost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != 2 || responses[0].Metadata != nil || responses[1].Metadata.Context != "42" {
+		t.Fatalf("expected a response without metadata and one for context 42, got %v", responses)
+	}
+}
+
+func TestErrorAndDelay(t *testing.T) {
+	const delay = 100 * time.Millisecond
+	s := fakeserver.New(fakeserver.Rule{Delay: delay, Err: status.Error(codes.Internal, "boom")})
+	defer s.Stop()
+	start := time.Now()
+	_, err := analyze(t, s, [2]string{"notes", "a"})
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("expected the Internal error, got %v", err)
+	}
+	if time.Since(start) < delay {
+		t.Fatal("expected the error after the delay")
+	}
+}
+
+func TestReset(t *testing.T) {
+	s := fakeserver.New(fakeserver.Rule{Reset: true, Times: 1}, fakeserver.Rule{Risks: []*pb.Risk{risk}})
+	defer s.Stop()
+	_, err := analyze(t, s, [2]string{"notes", "a"})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected the connection to be reset, got %v", err)
+	}
+	// the server still serves new connections
+	responses, err := analyze(t, s, [2]string{"notes", "a"})
+	if err != nil || len(responses) != 1 {
+		t.Fatalf("expected a risk after the reset, got %v, %v", responses, err)
+	}
+}